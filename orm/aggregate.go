@@ -0,0 +1,138 @@
+package orm
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+)
+
+// Count returns the number of rows of the session, ordering and limit
+// are ignored. Distinct, grouped, having or union queries count the
+// rows of the inner query, that is the number of groups. Select
+// ("DISTINCT name") counts the distinct names.
+func (m *Model) Count() (int64, error) {
+	m = m.instance()
+	return m.count()
+}
+
+// Sum returns SUM(column), 0 when there are no rows.
+func (m *Model) Sum(column string) (float64, error) {
+	m = m.instance()
+	var value sql.NullFloat64
+	err := m.aggregate("SUM("+quoteIdent(m.dialect, column)+")", &value)
+	return value.Float64, err
+}
+
+// Avg returns AVG(column), 0 when there are no rows.
+func (m *Model) Avg(column string) (float64, error) {
+	m = m.instance()
+	var value sql.NullFloat64
+	err := m.aggregate("AVG("+quoteIdent(m.dialect, column)+")", &value)
+	return value.Float64, err
+}
+
+// Min scans MIN(column) into the value dest points to, which is left
+// unchanged when there are no rows.
+func (m *Model) Min(column string, dest interface{}) error {
+	m = m.instance()
+	return m.aggregateInto("MIN("+quoteIdent(m.dialect, column)+")", dest)
+}
+
+// Max scans MAX(column) into the value dest points to, which is left
+// unchanged when there are no rows.
+func (m *Model) Max(column string, dest interface{}) error {
+	m = m.instance()
+	return m.aggregateInto("MAX("+quoteIdent(m.dialect, column)+")", dest)
+}
+
+// Exists reports whether the session matches at least one row.
+func (m *Model) Exists() (bool, error) {
+	m = m.instance()
+	if m.fields == "*" && m.distinct == "" && m.groupBy == "" {
+		m.fields, m.fieldArgs = "1", nil
+	}
+	m.Limit(1)
+	s, args := m.buildQuery()
+	found := false
+	err := m.query(s, args, func(rows *sql.Rows, columns []string) error {
+		found = rows.Next()
+		return nil
+	})
+	return found, err
+}
+
+// Pluck appends the values of column of every row to the slice dest
+// points to, the session ordering and limit are kept.
+//
+//	var names []string
+//	err := m.Table("user").Where("age > ?", 18).Pluck("name", &names)
+func (m *Model) Pluck(column string, dest interface{}) error {
+	m = m.instance()
+	refValue := reflect.ValueOf(dest)
+	if refValue.Kind() != reflect.Ptr || refValue.Elem().Kind() != reflect.Slice {
+		return errors.New("needs a pointer to a slice")
+	}
+	refValue = refValue.Elem()
+	elem := refValue.Type().Elem()
+	m.fields, m.fieldArgs = quoteIdent(m.dialect, column), nil
+	s, args := m.buildQuery()
+	return m.query(s, args, func(rows *sql.Rows, columns []string) error {
+		if len(columns) != 1 {
+			return errors.New("pluck needs a single column")
+		}
+		for rows.Next() {
+			value := reflect.New(elem).Elem()
+			if err := rows.Scan(scanTarget(value)); err != nil {
+				return err
+			}
+			refValue.Set(reflect.Append(refValue, value))
+		}
+		return nil
+	})
+}
+
+func (m *Model) count() (int64, error) {
+	var total int64
+	err := m.aggregate("COUNT(*)", &total)
+	return total, err
+}
+
+// aggregateInto scans the aggregate into dest through a pointer so
+// that a NULL result keeps dest unchanged.
+func (m *Model) aggregateInto(expr string, dest interface{}) error {
+	refValue := reflect.ValueOf(dest)
+	if refValue.Kind() != reflect.Ptr || refValue.IsNil() {
+		return errors.New("needs a pointer")
+	}
+	value := reflect.New(reflect.PtrTo(refValue.Elem().Type())).Elem()
+	if err := m.aggregate(expr, scanTarget(value)); err != nil {
+		return err
+	}
+	if !value.IsNil() {
+		refValue.Elem().Set(value.Elem())
+	}
+	return nil
+}
+
+// aggregate runs expr over the session without its ordering and limit
+// and scans the result into dest. Distinct, grouped, having or union
+// queries are aggregated through a derived table, expr then refers to
+// the columns selected by the session.
+func (m *Model) aggregate(expr string, dest interface{}) error {
+	var s string
+	var args []interface{}
+	if m.distinct != "" || isDistinct(m.fields) || m.groupBy != "" || m.having != "" || len(m.unions) > 0 {
+		s, args = m.buildSelect()
+		s = "SELECT " + expr + " FROM (" + s + ") aggregate_table"
+	} else {
+		where, whereArgs := m.where()
+		s = "SELECT " + expr + " FROM " + m.table + m.join + where
+		args = append(append([]interface{}(nil), m.tableArgs...), whereArgs...)
+	}
+	return m.query(s, args, func(rows *sql.Rows, columns []string) error {
+		if rows.Next() {
+			return rows.Scan(dest)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,186 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_BATCH_SIZE = 500
+)
+
+// OnConflict turns the next Insert or InsertBatch into an upsert on
+// the unique columns, the primary key when none are given. Without
+// DoUpdate the conflicting rows are left untouched.
+func (m *Model) OnConflict(columns ...string) *Model {
+	m = m.instance()
+	m.upsert = true
+	m.conflict = columns
+	return m
+}
+
+// DoUpdate lists the columns an upsert overwrites.
+func (m *Model) DoUpdate(columns ...string) *Model {
+	m = m.instance()
+	m.upsert = true
+	m.updates = columns
+	return m
+}
+
+// BatchSize sets the number of rows of one InsertBatch statement.
+func (m *Model) BatchSize(n int) *Model {
+	m = m.instance()
+	if n > 0 {
+		m.batchSize = n
+	}
+	return m
+}
+
+// Upsert inserts v or updates the columns of the row with the same
+// primary key, all non key columns are updated when none are given.
+// The default leaves out the auto create time columns. A version
+// column is never overwritten, it is incremented.
+func (m *Model) Upsert(v interface{}, columns ...string) (int64, error) {
+	m = m.instance()
+	if len(columns) == 0 {
+		if values, err := m.parse.Encode(v); err == nil {
+			refValue := reflect.Indirect(reflect.ValueOf(v))
+			pk, _ := m.parse.ScanPk(refValue)
+			delete(values, pk)
+			// the row keeps the time it was created at
+			for column := range m.parse.taggedColumns(refValue.Type(), AUTO_CREATE_TIME_TAG) {
+				delete(values, column)
+			}
+			columns = sortedKeys(values)
+		}
+	}
+	return m.DoUpdate(columns...).Insert(v)
+}
+
+// InsertBatch inserts a slice of structs with multi-row VALUES
+// statements of at most BatchSize rows and returns the number of
+// inserted rows. Run it in a transaction to make it atomic.
+func (m *Model) InsertBatch(v interface{}) (int64, error) {
+	m = m.instance()
+	ctx := m.ctx
+	defer m.flush()
+	refValue := reflect.Indirect(reflect.ValueOf(v))
+	if refValue.Kind() != reflect.Slice {
+		return 0, errors.New("needs a slice of structs")
+	}
+	if refValue.Len() == 0 {
+		return 0, nil
+	}
+	if _, ok := hookValue(refValue.Index(0)).(AfterInserter); ok && m.tx == nil {
+		return m.hookTx(func(s *Model) (int64, error) { return s.InsertBatch(v) })
+	}
+	elem := reflect.Indirect(refValue.Index(0))
+	m.bind(elem.Type())
+	now := time.Now()
+	rows := make([]map[string]interface{}, refValue.Len())
+	for i := range rows {
+		if err := m.beforeInsert(ctx, hookValue(refValue.Index(i))); err != nil {
+			return 0, err
+		}
+		columns, err := m.parse.Encode(refValue.Index(i).Interface())
+		if err != nil {
+			return 0, err
+		}
+		row := reflect.Indirect(refValue.Index(i))
+		m.parse.touch(row, columns, AUTO_CREATE_TIME_TAG, now, true)
+		m.parse.touch(row, columns, AUTO_UPDATE_TIME_TAG, now, true)
+		m.encodeSoftDelete(row.Type(), columns)
+		m.omit(columns)
+		rows[i] = columns
+	}
+	pk, _ := m.parse.ScanPk(elem)
+	if _, ok := rows[0][pk]; ok {
+		generated := true
+		for _, row := range rows {
+			generated = generated && isZero(row[pk])
+		}
+		if generated {
+			for _, row := range rows {
+				delete(row, pk)
+			}
+		}
+	}
+	keys := sortedKeys(rows[0])
+	if len(keys) == 0 {
+		return 0, errors.New("no columns to insert")
+	}
+	upsert, err := m.upsertClause(pk, keys)
+	if err != nil {
+		return 0, err
+	}
+	marks := ", (" + strings.TrimRight(strings.Repeat("?, ", len(keys)), ", ") + ")"
+	var total int64
+	for start := 0; start < len(rows); start += m.batchSize {
+		end := start + m.batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		args := make([]interface{}, 0, (end-start)*len(keys))
+		for _, row := range rows[start:end] {
+			for _, k := range keys {
+				args = append(args, row[k])
+			}
+		}
+		s := m.dialect.Insert(m.table, keys) + strings.Repeat(marks, end-start-1) + upsert
+		if _, err := m.exec(s, args...); err != nil {
+			return total, err
+		}
+		total += m.affectedRows
+	}
+	for i := 0; i < refValue.Len(); i++ {
+		if err := m.afterInsert(ctx, hookValue(refValue.Index(i))); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// hookValue returns a pointer to the slice element v so that
+// hooks declared on the pointer receiver are found.
+func hookValue(v reflect.Value) interface{} {
+	if v.Kind() != reflect.Ptr && v.CanAddr() {
+		return v.Addr().Interface()
+	}
+	return v.Interface()
+}
+
+func (m *Model) upsertClause(pk string, keys []string) (string, error) {
+	if !m.upsert {
+		return "", nil
+	}
+	conflict := m.conflict
+	if len(conflict) == 0 && pk != "" {
+		conflict = []string{pk}
+	}
+	if len(conflict) == 0 && len(m.updates) == 0 {
+		return "", errors.New("upsert needs conflict or update columns")
+	}
+	var versions map[string][]int
+	if m.model != nil {
+		versions = m.parse.taggedColumns(m.model, VERSION_TAG)
+	}
+	updates := make([]string, 0, len(m.updates))
+	for _, column := range m.updates {
+		if _, ok := versions[column]; !ok {
+			updates = append(updates, column)
+		}
+	}
+	s := m.dialect.Upsert(conflict, updates)
+	if len(updates) > 0 {
+		// the clause ends with its SET list, bump the version of the
+		// updated row instead of overwriting it
+		for column := range versions {
+			s += fmt.Sprintf(", %v = %v.%v + 1", m.dialect.Quote(column), m.table, m.dialect.Quote(column))
+			break
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,219 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var INVALID_CONDITION = errors.New("invalid condition")
+
+// Cond is a list of conditions joined with AND / OR. A Cond passed
+// to Where, AndWhere or OrWhere is rendered as a group in parentheses.
+type Cond struct {
+	parts []condPart
+	err   error
+}
+
+type condPart struct {
+	glue   string
+	column string
+	op     string
+	expr   string
+	group  *Cond
+	args   []interface{}
+}
+
+func NewCond() *Cond {
+	return &Cond{}
+}
+
+// And adds a condition with AND. query is a SQL string with "?"
+// placeholders, a Values or map[string]interface{} of column = value
+// pairs or a *Cond group. Any other type is kept as the error of c.
+func (c *Cond) And(query interface{}, args ...interface{}) *Cond {
+	return c.add("AND", query, args)
+}
+
+func (c *Cond) Or(query interface{}, args ...interface{}) *Cond {
+	return c.add("OR", query, args)
+}
+
+func (c *Cond) In(column string, values interface{}) *Cond {
+	return c.in("AND", column, " IN ", values)
+}
+
+func (c *Cond) NotIn(column string, values interface{}) *Cond {
+	return c.in("AND", column, " NOT IN ", values)
+}
+
+// Exists adds "EXISTS (subquery)" for the query of the session sub.
+func (c *Cond) Exists(sub *Model) *Cond {
+	return c.push(condPart{glue: "AND", expr: "EXISTS ?", args: []interface{}{sub}})
+}
+
+func (c *Cond) NotExists(sub *Model) *Cond {
+	return c.push(condPart{glue: "AND", expr: "NOT EXISTS ?", args: []interface{}{sub}})
+}
+
+func (c *Cond) Between(column string, from, to interface{}) *Cond {
+	return c.push(condPart{glue: "AND", column: column, op: " BETWEEN ? AND ?", args: []interface{}{from, to}})
+}
+
+func (c *Cond) Null(column string) *Cond {
+	return c.push(condPart{glue: "AND", column: column, op: " IS NULL"})
+}
+
+func (c *Cond) NotNull(column string) *Cond {
+	return c.push(condPart{glue: "AND", column: column, op: " IS NOT NULL"})
+}
+
+func (c *Cond) Like(column string, pattern string) *Cond {
+	return c.push(condPart{glue: "AND", column: column, op: " LIKE ?", args: []interface{}{pattern}})
+}
+
+func (c *Cond) Empty() bool {
+	return c == nil || len(c.parts) == 0
+}
+
+// Build returns the condition without the WHERE keyword and its
+// arguments in placeholder order.
+func (c *Cond) Build() (string, []interface{}) {
+	return c.build(func(column string) string { return column })
+}
+
+// build renders the columns through quote.
+func (c *Cond) build(quote func(string) string) (string, []interface{}) {
+	var b strings.Builder
+	args := make([]interface{}, 0)
+	if c.Empty() {
+		return "", args
+	}
+	for i, p := range c.parts {
+		if i > 0 {
+			b.WriteString(" " + p.glue + " ")
+		}
+		switch {
+		case p.group != nil:
+			s, a := p.group.build(quote)
+			b.WriteString("(" + s + ")")
+			args = append(args, a...)
+			continue
+		case p.column != "":
+			b.WriteString(quote(p.column) + p.op)
+		case len(c.parts) > 1:
+			// a raw expression may contain OR, keep its precedence
+			b.WriteString("(" + p.expr + ")")
+		default:
+			b.WriteString(p.expr)
+		}
+		args = append(args, p.args...)
+	}
+	return b.String(), args
+}
+
+func (c *Cond) add(glue string, query interface{}, args []interface{}) *Cond {
+	switch q := query.(type) {
+	case string:
+		return c.push(condPart{glue: glue, expr: q, args: args})
+	case map[string]interface{}:
+		return c.add(glue, Values(q), args)
+	case Values:
+		group := NewCond()
+		for _, k := range sortedKeys(q) {
+			switch v := q[k]; {
+			case v == nil:
+				group.Null(k)
+			case isList(v):
+				group.In(k, v)
+			default:
+				group.push(condPart{glue: "AND", column: k, op: " = ?", args: []interface{}{v}})
+			}
+		}
+		return c.group(glue, group)
+	case *Cond:
+		return c.group(glue, q)
+	}
+	if c.err == nil {
+		c.err = fmt.Errorf("%w: unsupported type %T", INVALID_CONDITION, query)
+	}
+	return c
+}
+
+// Err returns the first unsupported condition added to c or to one
+// of its groups.
+func (c *Cond) Err() error {
+	if c == nil {
+		return nil
+	}
+	return c.err
+}
+
+func (c *Cond) group(glue string, group *Cond) *Cond {
+	if c.err == nil {
+		c.err = group.Err()
+	}
+	if group.Empty() {
+		return c
+	}
+	if len(group.parts) == 1 {
+		p := group.parts[0]
+		p.glue = glue
+		return c.push(p)
+	}
+	return c.push(condPart{glue: glue, group: group})
+}
+
+func (c *Cond) in(glue, column, op string, values interface{}) *Cond {
+	if sub, ok := values.(*Model); ok {
+		return c.push(condPart{glue: glue, column: column, op: op + "?", args: []interface{}{sub}})
+	}
+	list := expand(values)
+	if len(list) == 0 {
+		// IN () is not valid SQL
+		if op == " IN " {
+			return c.push(condPart{glue: glue, expr: "1 = 0"})
+		}
+		return c.push(condPart{glue: glue, expr: "1 = 1"})
+	}
+	marks := strings.TrimRight(strings.Repeat("?, ", len(list)), ", ")
+	return c.push(condPart{glue: glue, column: column, op: op + "(" + marks + ")", args: list})
+}
+
+func (c *Cond) clone() *Cond {
+	if c == nil {
+		return NewCond()
+	}
+	return &Cond{parts: append([]condPart(nil), c.parts...), err: c.err}
+}
+
+func (c *Cond) push(p condPart) *Cond {
+	c.parts = append(c.parts, p)
+	return c
+}
+
+func isList(v interface{}) bool {
+	if _, ok := v.([]byte); ok {
+		return false
+	}
+	k := reflect.TypeOf(v).Kind()
+	return k == reflect.Slice || k == reflect.Array
+}
+
+// expand turns a slice or array into a list of arguments,
+// any other value is returned as a single argument.
+func expand(v interface{}) []interface{} {
+	if v == nil {
+		return nil
+	}
+	if !isList(v) {
+		return []interface{}{v}
+	}
+	ref := reflect.ValueOf(v)
+	list := make([]interface{}, ref.Len())
+	for i := range list {
+		list[i] = ref.Index(i).Interface()
+	}
+	return list
+}
@@ -1,14 +1,14 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
-	"losa/str"
 	"reflect"
-	"strconv"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -19,12 +19,17 @@ var (
 type Values map[string]interface{}
 
 type Field struct {
-	PrimaryKey bool
-	Name       string
-	Type       string
-	Null       bool
-	Default    string
-	Comment    string
+	PrimaryKey    bool
+	AutoIncrement bool
+	Name          string
+	Type          string
+	Null          bool
+	Default       string
+	Comment       string
+	// JSON columns hold the field marshalled to text
+	JSON bool
+	// GoType is the type of the struct field
+	GoType reflect.Type
 }
 
 const (
@@ -32,6 +37,13 @@ const (
 	IGNORE_TAG     = "ignore"
 	FIELD_TAG      = "field"
 	PK_TAG         = "pk"
+	AUTO_TAG       = "auto"
+	TYPE_TAG       = "type"
+	NULL_TAG       = "null"
+	DEFAULT_TAG    = "default"
+	COMMENT_TAG    = "comment"
+	PREFIX_TAG     = "prefix"
+	JSON_TAG       = "json"
 )
 
 type FieldTag struct {
@@ -58,7 +70,7 @@ func NewTag(tag string) *FieldTag {
 		data: make(map[string]string),
 	}
 	for _, val := range values {
-		v := strings.Split(val, ":")
+		v := strings.SplitN(val, ":", 2)
 		k := strings.TrimSpace(v[0])
 		if len(v) > 1 {
 			t.data[k] = strings.TrimSpace(v[1])
@@ -69,32 +81,44 @@ func NewTag(tag string) *FieldTag {
 	return t
 }
 
+// Parser maps structs to columns, the layout of every struct type
+// is parsed once and cached.
 type Parser struct {
-	err error
+	err     error
+	schemas sync.Map
 }
 
 func (p *Parser) TableName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
 	return strings.ToLower(t.Name())
 }
 
 func (p *Parser) ScanPk(value reflect.Value) (string, error) {
-	refType := value.Type()
-	for i := 0; i < refType.NumField(); i++ {
-		field := refType.Field(i)
-		tag := NewTag(field.Tag.Get(FIELD_TAG_NAME))
-		if tag.Has(PK_TAG) {
-			if tag.Has(FIELD_TAG) {
-				return tag.Get(FIELD_TAG), nil
-			}
-			return strings.ToLower(field.Name), nil
-		}
+	if pk := p.schema(value.Type()).pk; pk != nil {
+		return pk.name, nil
 	}
 	return "", errors.New("not scan primary key")
 }
 
+// pkField returns the primary key field of the struct value v,
+// allocating nil embedded pointers when v is addressable.
+func (p *Parser) pkField(v reflect.Value) (reflect.Value, *FieldTag, error) {
+	if pk := p.schema(v.Type()).pk; pk != nil {
+		if v.CanSet() {
+			return fieldByIndex(v, pk.index), pk.tag, nil
+		}
+		if field, ok := pk.value(v); ok {
+			return field, pk.tag, nil
+		}
+	}
+	return reflect.Value{}, nil, errors.New("not scan primary key")
+}
+
 func (p *Parser) FieldName(f reflect.StructField) (string, error) {
-	tag := NewTag(f.Tag.Get(FIELD_TAG_NAME))
-	if tag.Has(IGNORE_TAG) {
+	tag := tagOf(f)
+	if tag.Has(IGNORE_TAG) || tag.Has(REL_TAG) {
 		return "", errors.New(f.Name + " ignored")
 	}
 	if tag.Has(FIELD_TAG) {
@@ -103,18 +127,48 @@ func (p *Parser) FieldName(f reflect.StructField) (string, error) {
 	return strings.ToLower(f.Name), nil
 }
 
+// Fields returns the column definitions of struct t in field order,
+// anonymous embedded structs are flattened into the parent.
+func (p *Parser) Fields(t reflect.Type) []Field {
+	flat := p.schema(t).flat
+	fields := make([]Field, 0, len(flat))
+	for _, f := range flat {
+		fields = append(fields, Field{
+			PrimaryKey:    f.pk,
+			AutoIncrement: f.tag.Has(AUTO_TAG),
+			Name:          f.name,
+			Type:          f.tag.Get(TYPE_TAG),
+			Null:          f.tag.Has(NULL_TAG) || f.optional,
+			Default:       f.tag.Get(DEFAULT_TAG),
+			Comment:       f.tag.Get(COMMENT_TAG),
+			JSON:          f.json,
+			GoType:        f.field.Type,
+		})
+	}
+	return fields
+}
+
+// Encode returns the column values of struct v. Anonymous embedded
+// structs are flattened, nested structs tagged prefix are stored under
+// prefixed columns and fields tagged json are marshalled to text.
 func (p *Parser) Encode(v interface{}) (map[string]interface{}, error) {
 	result := make(map[string]interface{})
 	value := reflect.Indirect(reflect.ValueOf(v))
 	if value.Kind() != reflect.Struct {
 		return nil, errors.New("needs a pointer to a struct")
 	}
-	refType := value.Type()
-	for i := 0; i < refType.NumField(); i++ {
-		field := refType.Field(i)
-		if name, err := p.FieldName(field); err == nil {
-			result[name] = value.FieldByName(field.Name).Interface()
+	for _, f := range p.schema(value.Type()).flat {
+		field, ok := f.value(value)
+		if !ok {
+			// the nested struct is nil
+			result[f.name] = nil
+			continue
+		}
+		v, err := f.encode(field)
+		if err != nil {
+			return nil, err
 		}
+		result[f.name] = v
 	}
 	return result, nil
 }
@@ -124,82 +178,70 @@ func (p *Parser) Decode(data map[string][]byte, obj interface{}) error {
 	if ref.Kind() != reflect.Struct {
 		return errors.New("needs a pointer to a struct")
 	}
-	refType := ref.Type()
-
-	for i := 0; i < refType.NumField(); i++ {
-		field := refType.Field(i)
-		value := ref.Field(i)
-		if name, err := p.FieldName(field); err == nil {
-			var v interface{}
-			if val, ok := data[name]; ok {
-				switch field.Type.Kind() {
-				case reflect.String:
-					v = string(val)
-				case reflect.Bool:
-					v = string(val) == "1"
-				case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
-					if m, err := strconv.Atoi(string(val)); err == nil {
-						v = m
-					} else {
-						return INVALID_TYPE
-					}
-				case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-					if m, err := strconv.ParseUint(string(val), 10, 64); err == nil {
-						v = m
-					} else {
-						return INVALID_TYPE
-					}
-				case reflect.Int64:
-					if m, err := strconv.ParseInt(string(val), 10, 64); err == nil {
-						v = m
-					} else {
-						return INVALID_TYPE
-					}
-				case reflect.Float32, reflect.Float64:
-					if m, err := strconv.ParseFloat(string(val), 64); err == nil {
-						v = m
-					} else {
-						return INVALID_TYPE
-					}
-				case reflect.Struct:
-					if value.Type().String() == "time.Time" {
-						if timestrap, err := strconv.ParseInt(string(val), 10, 64); err == nil {
-							v = time.Unix(timestrap, 0)
-						} else if m, err := time.Parse("2006-01-02 15:04:05", string(val)); err == nil {
-							v = m
-						} else if m, err := time.Parse("2006-01-02 15:04:05.000 -0700", string(val)); err == nil {
-							v = m
-						} else {
-							return errors.New("unsupport type:" + value.Type().String())
-						}
-					}
-				default:
-					return errors.New("unsupport type:" + field.Type.Kind().String())
-
-				}
-				value.Set(reflect.ValueOf(v))
+	for _, f := range p.schema(ref.Type()).flat {
+		if val, ok := data[f.name]; ok {
+			if val == nil && f.optional {
+				continue
+			}
+			if err := f.decode(val, fieldByIndex(ref, f.index)); err != nil {
+				return err
 			}
 		}
 	}
 	return nil
 }
 
+// engine is shared by a root model and all of its sessions.
+type engine struct {
+	db       *sql.DB
+	replicas []*sql.DB
+	balancer Balancer
+	dialect  Dialect
+	parse    *Parser
+	logger   Logger
+	hooks    []QueryHook
+	stmts    *stmtCache
+}
+
+// Model is either a root, as returned by New and Begin, or a session
+// holding the state of one query chain. Builder and query methods called
+// on a root start a new session, so a root is safe for concurrent use
+// while a session must stay in one goroutine.
 type Model struct {
-	db    *sql.DB
-	parse *Parser
+	*engine
+	session bool
+	tx      *sql.Tx
+	depth   int
+	txCtx   context.Context
+	ctx     context.Context
 
 	//
 	primaryKey string
 	table      string
+	tableArgs  []interface{}
 	distinct   string
 	fields     string
+	fieldArgs  []interface{}
 	join       string
-	condition  string
+	cond       *Cond
 	groupBy    string
 	orderBy    string
+	sorts      []string
 	having     string
-	limit      string
-	params     []interface{}
+	unions     []union
+	limit      int
+	offset     int
+	batchSize  int
+	upsert     bool
+	conflict   []string
+	updates    []string
+	picks      []string
+	omits      []string
+	preloads   []string
+	model      reflect.Type
+	unscoped   bool
+	primary    bool
+	err        error
 
 	//
 	lastSql      string
@@ -207,155 +249,483 @@ type Model struct {
 	affectedRows int64
 }
 
-func (m *Model) Select(str string) *Model {
-	m.fields = str
+// Model starts a new session, the table is taken from v when given.
+func (m *Model) Model(v ...interface{}) *Model {
+	s := &Model{
+		engine:  m.engine,
+		session: true,
+		tx:      m.tx,
+		depth:   m.depth,
+		txCtx:   m.txCtx,
+	}
+	s.flush()
+	if len(v) > 0 && v[0] != nil {
+		s.bind(reflect.TypeOf(v[0]))
+	}
+	return s
+}
+
+// Session returns a copy of the current session, both can be
+// continued independently. On a root it is the same as Model.
+func (m *Model) Session() *Model {
+	if !m.session {
+		return m.Model()
+	}
+	s := *m
+	s.cond = m.cond.clone()
+	s.unions = append([]union(nil), m.unions...)
+	s.sorts = append([]string(nil), m.sorts...)
+	s.picks = append([]string(nil), m.picks...)
+	s.omits = append([]string(nil), m.omits...)
+	s.preloads = append([]string(nil), m.preloads...)
+	s.conflict = append([]string(nil), m.conflict...)
+	s.updates = append([]string(nil), m.updates...)
+	s.fieldArgs = append([]interface{}(nil), m.fieldArgs...)
+	s.tableArgs = append([]interface{}(nil), m.tableArgs...)
+	return &s
+}
+
+// derive starts a new session of m keeping its transaction, the
+// context given to WithContext and UsePrimary.
+func (m *Model) derive() *Model {
+	s := m.Model()
+	s.ctx, s.primary = m.ctx, m.primary
+	return s
+}
+
+// root panics unless m is the root model returned by New, the engine
+// settings are shared by every session and must not change under them.
+func (m *Model) root(setter string) {
+	if m.session || m.tx != nil {
+		panic("orm: " + setter + " needs the root model")
+	}
+}
+
+func (m *Model) instance() *Model {
+	if m.session {
+		return m
+	}
+	return m.Model()
+}
+
+// WithContext binds ctx to the next query executed by the model.
+func (m *Model) WithContext(ctx context.Context) *Model {
+	m = m.instance()
+	m.ctx = ctx
+	return m
+}
+
+func (m *Model) context() context.Context {
+	if m.ctx != nil {
+		return m.ctx
+	}
+	if m.txCtx != nil {
+		return m.txCtx
+	}
+	return context.Background()
+}
+
+// Select sets the selected columns, args fill its "?" placeholders,
+// a *Model argument is rendered as a subquery:
+//
+//	Select("id, ? AS orders", m.Table("orders").Select("COUNT(*)").Where("orders.user_id = user.id"))
+func (m *Model) Select(str string, args ...interface{}) *Model {
+	m = m.instance()
+	m.fields = quoteList(m.dialect, str)
+	m.fieldArgs = args
 	return m
 }
 
-func (m *Model) Table(str string) *Model {
-	return m.From(str)
+func (m *Model) Table(str string, args ...interface{}) *Model {
+	return m.From(str, args...)
 }
 
-func (m *Model) From(str string) *Model {
-	m.table = str
+// From sets the table, From("? AS t", sub) selects from the derived
+// table of the subquery sub.
+func (m *Model) From(str string, args ...interface{}) *Model {
+	m = m.instance()
+	m.table = quoteIdent(m.dialect, str)
+	m.tableArgs = args
 	return m
 }
 
 func (m *Model) Distinct(str string) *Model {
+	m = m.instance()
 	m.distinct = str
 	return m
 }
 
 func (m *Model) Join(join, table, condition string) *Model {
-	split := ""
-	if m.join != "" {
-		split = " , "
+	m = m.instance()
+	m.join = m.join + fmt.Sprintf(" %v JOIN %v ON %v", join, quoteIdent(m.dialect, table), condition)
+	return m
+}
+
+// Where adds a condition joined with AND. query is a SQL string
+// with "?" placeholders, a Values map or a *Cond group. An Expr
+// argument is written as is and a *Model one as a subquery:
+// Where("id IN ?", m.Table("orders").Select("user_id")).
+func (m *Model) Where(query interface{}, args ...interface{}) *Model {
+	m = m.instance()
+	if err := m.cond.And(query, args...).Err(); err != nil && m.err == nil {
+		m.err = err
 	}
-	m.join = m.join + fmt.Sprintf("%s %v JOIN %v ON %v", split, join, table, condition)
 	return m
 }
 
-func (m *Model) Where(str string, args ...interface{}) *Model {
-	m.condition = fmt.Sprintf(" WHERE %v", str)
-	m.params = args
+func (m *Model) AndWhere(query interface{}, args ...interface{}) *Model {
+	m = m.instance()
+	if err := m.cond.And(query, args...).Err(); err != nil && m.err == nil {
+		m.err = err
+	}
 	return m
 }
 
-func (m *Model) OrderBy(str string) *Model {
-	split := ""
-	if m.orderBy != "" {
-		split = " , "
+func (m *Model) OrWhere(query interface{}, args ...interface{}) *Model {
+	m = m.instance()
+	if err := m.cond.Or(query, args...).Err(); err != nil && m.err == nil {
+		m.err = err
+	}
+	return m
+}
+
+// WhereIn expands values, a slice or array, into "column IN (?, ?, ...)",
+// values may also be a *Model rendered as a subquery.
+func (m *Model) WhereIn(column string, values interface{}) *Model {
+	m = m.instance()
+	m.cond.In(column, values)
+	return m
+}
+
+func (m *Model) WhereNotIn(column string, values interface{}) *Model {
+	m = m.instance()
+	m.cond.NotIn(column, values)
+	return m
+}
+
+// WhereExists adds "EXISTS (subquery)" for the query of the session sub.
+func (m *Model) WhereExists(sub *Model) *Model {
+	m = m.instance()
+	m.cond.Exists(sub)
+	return m
+}
+
+func (m *Model) WhereNotExists(sub *Model) *Model {
+	m = m.instance()
+	m.cond.NotExists(sub)
+	return m
+}
+
+func (m *Model) WhereBetween(column string, from, to interface{}) *Model {
+	m = m.instance()
+	m.cond.Between(column, from, to)
+	return m
+}
+
+func (m *Model) WhereNull(column string) *Model {
+	m = m.instance()
+	m.cond.Null(column)
+	return m
+}
+
+func (m *Model) WhereNotNull(column string) *Model {
+	m = m.instance()
+	m.cond.NotNull(column)
+	return m
+}
+
+func (m *Model) WhereLike(column string, pattern string) *Model {
+	m = m.instance()
+	m.cond.Like(column, pattern)
+	return m
+}
+
+// OrderBy adds an ordering. OrderBy("name, id DESC") takes trusted SQL,
+// plain column names are quoted. With a direction the column is
+// validated when the query runs: it must be a column of the bound
+// struct and the direction ASC or DESC, so both may come from user
+// input: OrderBy(r.FormValue("sort"), r.FormValue("dir")).
+func (m *Model) OrderBy(str string, direction ...string) *Model {
+	m = m.instance()
+	if len(direction) > 0 {
+		if !isDirection(direction[0]) {
+			m.err = fmt.Errorf("%w: %q", INVALID_DIRECTION, direction[0])
+			return m
+		}
+		m.sorts = append(m.sorts, str)
+		str = m.dialect.Quote(str) + " " + strings.ToUpper(direction[0])
+	} else {
+		str = quoteList(m.dialect, str)
+	}
+	if m.orderBy == "" {
+		m.orderBy = " ORDER BY " + str
+	} else {
+		m.orderBy = m.orderBy + ", " + str
 	}
-	m.orderBy = m.orderBy + fmt.Sprintf(" %s ORDER BY  %v", split, str)
 	return m
 }
 
 func (m *Model) GroupBy(str string) *Model {
-	m.groupBy = m.groupBy + fmt.Sprintf(" GROUP BY  %v", str)
+	m = m.instance()
+	str = quoteList(m.dialect, str)
+	if m.groupBy == "" {
+		m.groupBy = " GROUP BY " + str
+	} else {
+		m.groupBy = m.groupBy + ", " + str
+	}
 	return m
 }
 
 func (m *Model) Having(str string) *Model {
+	m = m.instance()
 	m.having = fmt.Sprintf(" HAVING %v", str)
 	return m
 }
 
+// Limit(n) or Limit(offset, n)
 func (m *Model) Limit(args ...int) *Model {
+	m = m.instance()
 	if len(args) > 1 {
-		m.limit = fmt.Sprintf(" LIMIT %v,%v", args[0], args[1])
+		m.offset, m.limit = args[0], args[1]
 	} else {
-		m.limit = fmt.Sprintf(" LIMIT %v", args[0])
+		m.offset, m.limit = 0, args[0]
 	}
 	return m
 }
 
+// Save inserts v when its primary key is the zero value and updates it
+// otherwise, the primary key value is returned. A key generated by the
+// database is written back into v. A non zero key without the auto tag
+// is client generated, the row is inserted if it does not exist yet.
 func (m *Model) Save(v interface{}) (interface{}, error) {
-	return nil, nil
+	m = m.instance()
+	refValue := reflect.ValueOf(v)
+	if refValue.Kind() != reflect.Ptr || refValue.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("needs a pointer to a struct")
+	}
+	refValue = refValue.Elem()
+	field, tag, err := m.parse.pkField(refValue)
+	if err != nil {
+		return nil, err
+	}
+	m.bind(refValue.Type())
+	if field.IsZero() {
+		if _, err := m.Insert(v); err != nil {
+			return nil, err
+		}
+		setGeneratedKey(field, m.lastInsertId)
+		return field.Interface(), nil
+	}
+	if !tag.Has(AUTO_TAG) {
+		pk, _ := m.parse.ScanPk(refValue)
+		row, err := m.derive().Table(m.table).Unscoped().UsePrimary().Select(pk).Where(Values{pk: field.Interface()}).QueryOne()
+		if err != nil {
+			return nil, err
+		}
+		if row == nil {
+			_, err := m.Insert(v)
+			return field.Interface(), err
+		}
+	}
+	_, err = m.Update(v)
+	return field.Interface(), err
 }
 
 func (m *Model) Insert(v interface{}) (int64, error) {
+	m = m.instance()
+	ctx := m.ctx
+	if _, ok := v.(AfterInserter); ok && m.tx == nil {
+		return m.hookTx(func(s *Model) (int64, error) { return s.Insert(v) })
+	}
 	refValue := reflect.Indirect(reflect.ValueOf(v))
 	if refValue.Kind() != reflect.Struct {
 		return 0, errors.New("needs a pointer to a struct")
 	}
+	if err := m.beforeInsert(ctx, v); err != nil {
+		return 0, err
+	}
 	columns, err := m.parse.Encode(v)
 	if err != nil {
 		return 0, err
 	}
-	if m.table == "" {
-		m.table = m.parse.TableName(reflect.TypeOf(v))
+	m.bind(refValue.Type())
+	now := time.Now()
+	m.parse.touch(refValue, columns, AUTO_CREATE_TIME_TAG, now, true)
+	m.parse.touch(refValue, columns, AUTO_UPDATE_TIME_TAG, now, true)
+	m.encodeSoftDelete(refValue.Type(), columns)
+	m.omit(columns)
+	pk, _ := m.parse.ScanPk(refValue)
+	generated := false
+	if pkv, ok := columns[pk]; ok && isZero(pkv) {
+		// let the database generate the key
+		delete(columns, pk)
+		generated = true
 	}
-	keys, values := m.parseColumns(columns)
-	s := populateSql("INSERT INTO %TABLE% SET %VALUES% ", map[string]string{
-		"%TABLE%":  m.table,
-		"%VALUES%": keys,
-	})
-	return m.Execute(s, values...)
+	keys := sortedKeys(columns)
+	values := make([]interface{}, len(keys))
+	for i, k := range keys {
+		values[i] = columns[k]
+	}
+	upsert, err := m.upsertClause(pk, keys)
+	if err != nil {
+		return 0, err
+	}
+	s := m.dialect.Insert(m.table, keys) + upsert
+	returning := ""
+	field, tag, err := m.parse.pkField(refValue)
+	if err == nil && (generated || tag.Has(AUTO_TAG)) {
+		returning = m.dialect.Returning(pk)
+	}
+	var n int64
+	if returning != "" {
+		// read the key back into a value of its own type
+		key := reflect.New(field.Type())
+		if n, err = m.executeReturning(key.Interface(), s+returning, values...); err == nil && n > 0 {
+			if field.CanSet() {
+				field.Set(key.Elem())
+			}
+			switch field.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				m.lastInsertId, n = field.Int(), field.Int()
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				m.lastInsertId, n = int64(field.Uint()), int64(field.Uint())
+			}
+		}
+	} else {
+		n, err = m.Execute(s, values...)
+	}
+	if err != nil {
+		return 0, err
+	}
+	m.remember(refValue, columns)
+	return n, m.afterInsert(ctx, v)
 }
 
+// Update saves v by primary key. When v has an integer field tagged
+// version the row is only updated if its version is unchanged, the
+// version is then incremented, otherwise *ErrStaleObject is returned.
+// Every column is written unless v embeds Tracked, then only the
+// columns changed since it was found or saved are, and nothing when
+// none did. See UpdateColumns and Omit.
 func (m *Model) Update(v interface{}) (int64, error) {
+	m = m.instance()
+	ctx := m.ctx
+	if _, ok := v.(AfterUpdater); ok && m.tx == nil {
+		return m.hookTx(func(s *Model) (int64, error) { return s.Update(v) })
+	}
 	refValue := reflect.Indirect(reflect.ValueOf(v))
 	if refValue.Kind() != reflect.Struct {
 		return 0, errors.New("needs a pointer to a struct")
 	}
+	if err := m.beforeUpdate(ctx, v); err != nil {
+		return 0, err
+	}
 	columns, err := m.parse.Encode(v)
 	if err != nil {
 		return 0, err
 	}
-	if pk, err := m.parse.ScanPk(refValue); err != nil {
+	pk, err := m.parse.ScanPk(refValue)
+	if err != nil {
 		return 0, err
-	} else {
-		if pkv, ok := columns[pk]; ok {
-			m.Where(pk+" = ?", pkv)
-			delete(columns, pk)
-		}
 	}
-	if m.table == "" {
-		m.table = m.parse.TableName(reflect.TypeOf(v))
+	pkv, ok := columns[pk]
+	if ok {
+		m.Where(Values{pk: pkv})
+		delete(columns, pk)
 	}
-	keys, values := m.parseColumns(columns)
-	s := populateSql("UPDATE %TABLE% SET %VALUES% %WHERE%%ORDER%%LIMIT%", map[string]string{
-		"%TABLE%":  m.table,
-		"%VALUES%": keys,
-		"%WHERE%":  m.condition,
-		"%ORDER%":  m.orderBy,
-		"%LIMIT%":  m.limit,
-	})
-	m.params = append(values, m.params...)
-	return m.Execute(s, m.params...)
+	m.bind(refValue.Type())
+	if changed, err := m.pick(refValue, columns); err != nil {
+		return 0, err
+	} else if !changed {
+		// nothing to write
+		m.flush()
+		return 0, m.afterUpdate(ctx, v)
+	}
+	m.parse.touch(refValue, columns, AUTO_UPDATE_TIME_TAG, time.Now(), false)
+	m.encodeSoftDelete(refValue.Type(), columns)
+	m.omit(columns)
+	lock, err := m.lockVersion(refValue, columns)
+	if err != nil {
+		return 0, err
+	}
+	n, err := m.update(columns)
+	if err != nil {
+		return 0, err
+	}
+	if lock != nil {
+		if n == 0 {
+			return 0, &ErrStaleObject{Table: m.parse.TableName(refValue.Type()), Key: pkv, Version: lock.value}
+		}
+		lock.commit()
+	}
+	m.remember(refValue, columns)
+	return n, m.afterUpdate(ctx, v)
 }
 
 func (m *Model) Delete(v interface{}) (int64, error) {
-	if m.condition == "" {
+	m = m.instance()
+	ctx := m.ctx
+	if _, ok := v.(AfterDeleter); ok && m.tx == nil {
+		return m.hookTx(func(s *Model) (int64, error) { return s.Delete(v) })
+	}
+	if v != nil {
 		refValue := reflect.Indirect(reflect.ValueOf(v))
 		if refValue.Kind() != reflect.Struct {
 			return 0, errors.New("needs a pointer to a struct")
 		}
-		columns, err := m.parse.Encode(v)
-		if err != nil {
+		if err := m.beforeDelete(ctx, v); err != nil {
 			return 0, err
 		}
-		if pk, err := m.parse.ScanPk(refValue); err != nil {
-			return 0, err
-		} else {
-			if pkv, ok := columns[pk]; ok {
-				m.Where(pk+" = ?", pkv)
+		m.bind(refValue.Type())
+		if m.cond.Empty() {
+			columns, err := m.parse.Encode(v)
+			if err != nil {
+				return 0, err
+			}
+			if pk, err := m.parse.ScanPk(refValue); err != nil {
+				return 0, err
+			} else {
+				if pkv, ok := columns[pk]; ok {
+					m.Where(Values{pk: pkv})
+				}
 			}
-		}
-		if m.table == "" {
-			m.table = m.parse.TableName(reflect.TypeOf(v))
 		}
 	}
+	where, args := m.where()
 	s := populateSql("DELETE FROM %TABLE% %WHERE%%ORDER%%LIMIT%", map[string]string{
 		"%TABLE%": m.table,
-		"%WHERE%": m.condition,
+		"%WHERE%": where,
 		"%ORDER%": m.orderBy,
-		"%LIMIT%": m.limit,
+		"%LIMIT%": m.dialect.Limit(m.limit, m.offset),
 	})
-	return m.Execute(s, m.params...)
+	if column, t, ok := m.softDeleteColumn(); ok {
+		// keep the row and mark it deleted
+		now := time.Now()
+		if v != nil {
+			m.parse.touch(reflect.Indirect(reflect.ValueOf(v)), map[string]interface{}{}, SOFT_DELETE_TAG, now, false)
+		}
+		s = populateSql("UPDATE %TABLE% SET %VALUES% %WHERE%%ORDER%%LIMIT%", map[string]string{
+			"%TABLE%":  m.table,
+			"%VALUES%": m.dialect.Quote(column) + " = ?",
+			"%WHERE%":  where,
+			"%ORDER%":  m.orderBy,
+			"%LIMIT%":  m.dialect.Limit(m.limit, m.offset),
+		})
+		value, ok := timeValue(t, now)
+		if !ok {
+			defer m.flush()
+			return 0, m.parse.schema(m.model).err
+		}
+		args = append([]interface{}{value.Interface()}, args...)
+	}
+	if _, err := m.Execute(s, args...); err != nil || v == nil {
+		return m.affectedRows, err
+	}
+	return m.affectedRows, m.afterDelete(ctx, v)
 }
 
 func (m *Model) QueryOne() (map[string][]byte, error) {
+	m = m.instance()
 	m.Limit(1)
 	if values, err := m.QueryAll(); err == nil {
 		if len(values) > 0 {
@@ -369,11 +739,13 @@ func (m *Model) QueryOne() (map[string][]byte, error) {
 }
 
 func (m *Model) QueryAll() ([]map[string][]byte, error) {
-	s := m.buildQuery()
-	return m.Query(s, m.params...)
+	m = m.instance()
+	s, args := m.buildQuery()
+	return m.Query(s, args...)
 }
 
 func (m *Model) QueryScalar() ([]byte, error) {
+	m = m.instance()
 	value, err := m.QueryOne()
 	if err == nil {
 		for _, v := range value {
@@ -383,22 +755,43 @@ func (m *Model) QueryScalar() ([]byte, error) {
 	return nil, err
 }
 
+// FindOne scans the first row into the struct v, the fields are
+// matched to the columns by name and scanned with database/sql rules.
 func (m *Model) FindOne(v interface{}) error {
+	m = m.instance()
+	ctx := m.ctx
 	refValue := reflect.Indirect(reflect.ValueOf(v))
 	if refValue.Kind() != reflect.Struct {
 		return errors.New("needs a pointer to a struct")
 	}
-	if m.table == "" {
-		m.table = m.parse.TableName(reflect.TypeOf(v))
+	m.bind(refValue.Type())
+	m.Limit(1)
+	s, args := m.buildQuery()
+	// preload queries keep the context and routing of the session
+	preloads, base := m.preloads, m.derive()
+	found := false
+	err := m.query(s, args, func(rows *sql.Rows, columns []string) error {
+		if rows.Next() {
+			found = true
+			return m.parse.scanStruct(rows, columns, refValue)
+		}
+		return nil
+	})
+	if err != nil || !found {
+		return err
 	}
-	if val, err := m.QueryOne(); err != nil {
+	m.remember(refValue, nil)
+	records := []reflect.Value{refValue}
+	if err := base.preload(records, preloads); err != nil {
 		return err
-	} else {
-		return m.parse.Decode(val, v)
 	}
+	return m.afterFind(ctx, records)
 }
 
+// FindAll appends a struct to the slice v for every row, see FindOne.
 func (m *Model) FindAll(v interface{}) error {
+	m = m.instance()
+	ctx := m.ctx
 	refValue := reflect.Indirect(reflect.ValueOf(v))
 	if refValue.Kind() != reflect.Slice {
 		return errors.New("needs a pointer to a slice")
@@ -407,114 +800,272 @@ func (m *Model) FindAll(v interface{}) error {
 	if refElem.Kind() != reflect.Struct {
 		return errors.New("needs a pointer to a struct")
 	}
-	if m.table == "" {
-		m.table = m.parse.TableName(refElem)
-	}
-	if values, err := m.QueryAll(); err != nil {
-		return err
-	} else {
-		for _, val := range values {
-			ins := reflect.New(refElem)
-			if err := m.parse.Decode(val, ins.Interface()); err == nil {
-				refValue.Set(reflect.Append(refValue, reflect.Indirect(reflect.ValueOf(ins.Interface()))))
-			} else {
-				log.Println(err)
+	m.bind(refElem)
+	s, args := m.buildQuery()
+	// preload queries keep the context and routing of the session
+	preloads, base := m.preloads, m.derive()
+	start := refValue.Len()
+	err := m.query(s, args, func(rows *sql.Rows, columns []string) error {
+		for rows.Next() {
+			ins := reflect.New(refElem).Elem()
+			if err := m.parse.scanStruct(rows, columns, ins); err != nil {
+				return err
 			}
+			refValue.Set(reflect.Append(refValue, ins))
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	return nil
+	records := make([]reflect.Value, 0, refValue.Len()-start)
+	for i := start; i < refValue.Len(); i++ {
+		m.remember(refValue.Index(i), nil)
+		records = append(records, refValue.Index(i))
+	}
+	if err := base.preload(records, preloads); err != nil {
+		return err
+	}
+	return m.afterFind(ctx, records)
 }
 
 func (m *Model) parseColumns(columns map[string]interface{}) (string, []interface{}) {
 	s := ""
 	params := make([]interface{}, 0)
 	if len(columns) > 0 {
-		for k, v := range columns {
-			s = s + k + " = ?,"
-			params = append(params, v)
+		for _, k := range sortedKeys(columns) {
+			s = s + m.dialect.Quote(k) + " = ?,"
+			params = append(params, columns[k])
 		}
 		s = strings.TrimRight(s, ",")
 	}
 	return s, params
 }
 
-func (m *Model) buildQuery() string {
+func (m *Model) where() (string, []interface{}) {
+	s, args := m.scope().build(func(column string) string {
+		return quoteIdent(m.dialect, column)
+	})
+	if s != "" {
+		s = " WHERE " + s
+	}
+	return s, args
+}
+
+func (m *Model) buildQuery() (string, []interface{}) {
+	s, args := m.buildSelect()
+	return s + m.orderBy + m.dialect.Limit(m.limit, m.offset), args
+}
+
+// buildSelect returns the query and its unions without the ordering
+// and limit, which apply to the whole compound query.
+func (m *Model) buildSelect() (string, []interface{}) {
 	//'SELECT%DISTINCT% %FIELD% FROM %TABLE%%JOIN%%WHERE%%GROUP%%HAVING%%ORDER%%LIMIT% %UNION%%COMMENT%';
-	s := "SELECT %DISTINCT% %FIELD% FROM %TABLE%%JOIN%%WHERE%%GROUP%%HAVING%%ORDER%%LIMIT%"
+	s := "SELECT %DISTINCT% %FIELD% FROM %TABLE%%JOIN%%WHERE%%GROUP%%HAVING%%UNION%"
+	where, whereArgs := m.where()
+	args := make([]interface{}, 0, len(m.fieldArgs)+len(m.tableArgs)+len(whereArgs))
+	args = append(append(append(args, m.fieldArgs...), m.tableArgs...), whereArgs...)
+	union := ""
+	for _, u := range m.unions {
+		us, uargs := u.query.buildQuery()
+		union += u.op + us
+		args = append(args, uargs...)
+	}
 	replaceMap := map[string]string{
 		"%TABLE%":    m.table,
 		"%DISTINCT%": m.distinct,
 		"%FIELD%":    m.fields,
 		"%JOIN%":     m.join,
-		"%WHERE%":    m.condition,
+		"%WHERE%":    where,
 		"%GROUP%":    m.groupBy,
 		"%HAVING%":   m.having,
-		"%ORDER%":    m.orderBy,
-		"%LIMIT%":    m.limit,
+		"%UNION%":    union,
 	}
-	return populateSql(s, replaceMap)
+	return populateSql(s, replaceMap), args
 }
 
 func (m *Model) Query(str string, args ...interface{}) ([]map[string][]byte, error) {
-	defer m.flush()
-	m.lastSql = str
-	stmt, err := m.db.Prepare(str)
-	if err != nil {
-		return nil, err
-	}
-	defer stmt.Close()
-	log.Println(m.lastSql)
-	res, err := stmt.Query(args...)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Close()
-	columns, err := res.Columns()
+	m = m.instance()
+	result := make([]map[string][]byte, 0)
+	err := m.query(str, args, func(rows *sql.Rows, columns []string) error {
+		values := make([][]byte, len(columns))
+		scanArgs := make([]interface{}, len(values))
+		for i := range values {
+			scanArgs[i] = &values[i]
+		}
+		for rows.Next() {
+			if err := rows.Scan(scanArgs...); err != nil {
+				return err
+			}
+			value := make(map[string][]byte)
+			for i, col := range values {
+				value[columns[i]] = col
+			}
+			result = append(result, value)
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	values := make([][]byte, len(columns))
-	scanArgs := make([]interface{}, len(values))
-	for i := range values {
-		scanArgs[i] = &values[i]
+	return result, nil
+}
+
+// query runs str and hands the open result set to fn.
+func (m *Model) query(str string, args []interface{}, fn func(rows *sql.Rows, columns []string) error) error {
+	defer m.flush()
+	if err := m.checkSorts(); err != nil {
+		return err
 	}
-	result := make([]map[string][]byte, 0)
-	for res.Next() {
-		err = res.Scan(scanArgs...)
+	str, args = inline(str, args)
+	m.lastSql = str
+	return m.trace(str, args, func(ctx context.Context) (int64, error) {
+		stmt, release, err := m.prepare(ctx, m.reader(), rebind(m.dialect, str))
 		if err != nil {
-			return nil, err
+			return -1, err
 		}
-		value := make(map[string][]byte)
-		for i, col := range values {
-			value[columns[i]] = col
+		res, err := stmt.QueryContext(ctx, args...)
+		if err != nil {
+			release(true)
+			return -1, err
 		}
-		result = append(result, value)
-	}
-	if res.Err() != nil {
-		return nil, res.Err()
-	}
-	return result, nil
+		defer release(false)
+		defer res.Close()
+		columns, err := res.Columns()
+		if err != nil {
+			return -1, err
+		}
+		if err := fn(res, columns); err != nil {
+			return -1, err
+		}
+		return -1, res.Err()
+	})
 }
 
 func (m *Model) Execute(str string, args ...interface{}) (int64, error) {
+	m = m.instance()
 	defer m.flush()
-	m.lastSql = str
-	log.Println(m.lastSql)
-	if res, err := m.db.Exec(str, args...); err != nil {
+	if _, err := m.exec(str, args...); err != nil {
 		return 0, err
-	} else {
+	}
+	if m.lastInsertId > 0 {
+		return m.lastInsertId, nil
+	}
+	return m.affectedRows, nil
+}
+
+// ExecRaw runs str unchanged on the transaction of m or the primary db,
+// its "?" are not rebound to the dialect, so it suits SQL scripts such
+// as migrations.
+func (m *Model) ExecRaw(str string) (int64, error) {
+	var n int64
+	err := m.trace(str, nil, func(ctx context.Context) (int64, error) {
+		res, err := m.executor().ExecContext(ctx, str)
+		if err != nil {
+			return 0, err
+		}
+		n, _ = res.RowsAffected()
+		return n, nil
+	})
+	return n, err
+}
+
+// exec runs str without resetting the session.
+func (m *Model) exec(str string, args ...interface{}) (sql.Result, error) {
+	if err := m.checkSorts(); err != nil {
+		return nil, err
+	}
+	str, args = inline(str, args)
+	m.lastSql = str
+	m.lastInsertId = 0
+	m.affectedRows = 0
+	var res sql.Result
+	err := m.trace(str, args, func(ctx context.Context) (int64, error) {
+		var err error
+		if res, err = m.executor().ExecContext(ctx, rebind(m.dialect, str), args...); err != nil {
+			return 0, err
+		}
 		if id, err := res.LastInsertId(); err == nil {
 			m.lastInsertId = id
 		}
 		if rows, err := res.RowsAffected(); err == nil {
 			m.affectedRows = rows
 		}
-		if m.lastInsertId > 0 {
-			return m.lastInsertId, nil
-		} else {
-			return m.affectedRows, nil
+		return m.affectedRows, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// executeReturning runs an INSERT ... RETURNING statement and
+// reads the generated key from the single returned row.
+func (m *Model) executeReturning(dest interface{}, str string, args ...interface{}) (int64, error) {
+	defer m.flush()
+	if err := m.checkSorts(); err != nil {
+		return 0, err
+	}
+	str, args = inline(str, args)
+	m.lastSql = str
+	m.lastInsertId = 0
+	m.affectedRows = 0
+	err := m.trace(str, args, func(ctx context.Context) (int64, error) {
+		err := m.executor().QueryRowContext(ctx, rebind(m.dialect, str), args...).Scan(dest)
+		if err == sql.ErrNoRows {
+			// an upsert left the conflicting row as it is
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
 		}
+		m.affectedRows = 1
+		return 1, nil
+	})
+	if err != nil {
+		return 0, err
 	}
+	return m.affectedRows, nil
+}
+
+func (m *Model) QueryContext(ctx context.Context, str string, args ...interface{}) ([]map[string][]byte, error) {
+	return m.WithContext(ctx).Query(str, args...)
+}
+
+func (m *Model) ExecuteContext(ctx context.Context, str string, args ...interface{}) (int64, error) {
+	return m.WithContext(ctx).Execute(str, args...)
+}
+
+func (m *Model) FindOneContext(ctx context.Context, v interface{}) error {
+	return m.WithContext(ctx).FindOne(v)
+}
+
+func (m *Model) FindAllContext(ctx context.Context, v interface{}) error {
+	return m.WithContext(ctx).FindAll(v)
+}
+
+func (m *Model) InsertContext(ctx context.Context, v interface{}) (int64, error) {
+	return m.WithContext(ctx).Insert(v)
+}
+
+func (m *Model) UpdateContext(ctx context.Context, v interface{}) (int64, error) {
+	return m.WithContext(ctx).Update(v)
+}
+
+func (m *Model) DeleteContext(ctx context.Context, v interface{}) (int64, error) {
+	return m.WithContext(ctx).Delete(v)
+}
+
+func (m *Model) DB() *sql.DB {
+	return m.db
+}
+
+func (m *Model) Dialect() Dialect {
+	return m.dialect
+}
+
+func (m *Model) Parser() *Parser {
+	return m.parse
 }
 
 func (m *Model) LastSql() string {
@@ -528,17 +1079,45 @@ func (m *Model) LastInsertId() int64 {
 func (m *Model) flush() {
 	m.primaryKey = ""
 	m.table = ""
+	m.tableArgs = nil
 	m.distinct = ""
 	m.fields = "*"
+	m.fieldArgs = nil
 	m.join = ""
-	m.condition = ""
+	m.cond = NewCond()
 	m.groupBy = ""
 	m.orderBy = ""
+	m.sorts = nil
 	m.having = ""
-	m.limit = ""
-	m.lastInsertId = 0
-	m.affectedRows = 0
-	m.params = make([]interface{}, 0)
+	m.unions = nil
+	m.limit = -1
+	m.offset = 0
+	m.batchSize = DEFAULT_BATCH_SIZE
+	m.upsert = false
+	m.conflict = nil
+	m.updates = nil
+	m.picks = nil
+	m.omits = nil
+	m.preloads = nil
+	m.model = nil
+	m.unscoped = false
+	m.primary = false
+	m.err = nil
+	m.ctx = nil
+}
+
+// setGeneratedKey writes the key generated by the database into the
+// integer primary key field.
+func setGeneratedKey(field reflect.Value, id int64) {
+	if id <= 0 {
+		return
+	}
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		field.SetInt(id)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		field.SetUint(uint64(id))
+	}
 }
 
 //replace sql
@@ -549,12 +1128,41 @@ func populateSql(s string, pairs map[string]string) string {
 	return s
 }
 
-func New(db *sql.DB) *Model {
+func sortedKeys(columns map[string]interface{}) []string {
+	keys := make([]string, 0, len(columns))
+	for k := range columns {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isZero(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	return reflect.ValueOf(v).IsZero()
+}
+
+// New returns the root model of the primary db, a nil dialect defaults
+// to MySQL. Reads outside of a transaction are spread over the replicas
+// when given, writes and transactions always use the primary. Errors
+// and slow statements are logged, see SetLogger.
+func New(db *sql.DB, dialect Dialect, replicas ...*sql.DB) *Model {
+	if dialect == nil {
+		dialect = MySQL{}
+	}
 	m := &Model{
-		db:     db,
-		parse:  &Parser{},
-		fields: "*",
-		params: make([]interface{}, 0),
+		engine: &engine{
+			db:       db,
+			replicas: replicas,
+			balancer: &RoundRobin{},
+			dialect:  dialect,
+			parse:    &Parser{},
+			logger:   NewLogger(nil, LOG_WARN),
+			stmts:    newStmtCache(DEFAULT_STMT_CACHE_SIZE),
+		},
 	}
+	m.flush()
 	return m
 }
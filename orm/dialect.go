@@ -0,0 +1,227 @@
+package orm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect hides the SQL differences between database servers.
+// The query builder always writes "?" placeholders, they are
+// rewritten through Placeholder right before the query is sent.
+type Dialect interface {
+	Name() string
+	// Placeholder returns the bind variable for the n-th argument, starting at 1.
+	Placeholder(n int) string
+	Quote(name string) string
+	// Limit returns the LIMIT/OFFSET clause, limit < 0 means no limit.
+	Limit(limit, offset int) string
+	Insert(table string, columns []string) string
+	// Returning returns the clause appended to INSERT to read back the
+	// generated key, or "" when the driver supports LastInsertId.
+	Returning(column string) string
+	// Upsert returns the clause appended to INSERT that updates the
+	// columns update of the row conflicting on the columns conflict.
+	Upsert(conflict []string, update []string) string
+}
+
+type MySQL struct{}
+
+func (MySQL) Name() string {
+	return "mysql"
+}
+
+func (MySQL) Placeholder(n int) string {
+	return "?"
+}
+
+func (MySQL) Quote(name string) string {
+	return quoteWith(name, "`")
+}
+
+func (MySQL) Limit(limit, offset int) string {
+	if limit < 0 {
+		if offset > 0 {
+			return fmt.Sprintf(" LIMIT %v,18446744073709551615", offset)
+		}
+		return ""
+	}
+	if offset > 0 {
+		return fmt.Sprintf(" LIMIT %v,%v", offset, limit)
+	}
+	return fmt.Sprintf(" LIMIT %v", limit)
+}
+
+func (d MySQL) Insert(table string, columns []string) string {
+	if len(columns) == 0 {
+		return fmt.Sprintf("INSERT INTO %v () VALUES ()", table)
+	}
+	return insertValues(d, table, columns)
+}
+
+func (MySQL) Returning(column string) string {
+	return ""
+}
+
+// Upsert ignores conflict, MySQL checks every unique key. Without
+// update the first conflict column is set to itself, one of them is
+// required.
+func (d MySQL) Upsert(conflict []string, update []string) string {
+	sets := make([]string, 0, len(update))
+	for _, col := range update {
+		sets = append(sets, fmt.Sprintf("%v = VALUES(%v)", d.Quote(col), d.Quote(col)))
+	}
+	if len(sets) == 0 && len(conflict) > 0 {
+		// nothing to update, keep the row as it is
+		sets = append(sets, fmt.Sprintf("%v = %v", d.Quote(conflict[0]), d.Quote(conflict[0])))
+	}
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+type PostgreSQL struct{}
+
+func (PostgreSQL) Name() string {
+	return "postgres"
+}
+
+func (PostgreSQL) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func (PostgreSQL) Quote(name string) string {
+	return quoteWith(name, `"`)
+}
+
+func (PostgreSQL) Limit(limit, offset int) string {
+	return limitOffset(limit, offset, "")
+}
+
+func (d PostgreSQL) Insert(table string, columns []string) string {
+	if len(columns) == 0 {
+		return fmt.Sprintf("INSERT INTO %v DEFAULT VALUES", table)
+	}
+	return insertValues(d, table, columns)
+}
+
+func (d PostgreSQL) Returning(column string) string {
+	if column == "" {
+		return ""
+	}
+	return " RETURNING " + d.Quote(column)
+}
+
+func (d PostgreSQL) Upsert(conflict []string, update []string) string {
+	return onConflict(d, conflict, update)
+}
+
+type SQLite struct{}
+
+func (SQLite) Name() string {
+	return "sqlite"
+}
+
+func (SQLite) Placeholder(n int) string {
+	return "?"
+}
+
+func (SQLite) Quote(name string) string {
+	return quoteWith(name, `"`)
+}
+
+func (SQLite) Limit(limit, offset int) string {
+	return limitOffset(limit, offset, " LIMIT -1")
+}
+
+func (d SQLite) Insert(table string, columns []string) string {
+	if len(columns) == 0 {
+		return fmt.Sprintf("INSERT INTO %v DEFAULT VALUES", table)
+	}
+	return insertValues(d, table, columns)
+}
+
+func (SQLite) Returning(column string) string {
+	return ""
+}
+
+func (d SQLite) Upsert(conflict []string, update []string) string {
+	return onConflict(d, conflict, update)
+}
+
+// onConflict is the PostgreSQL syntax SQLite supports since 3.24.
+func onConflict(d Dialect, conflict []string, update []string) string {
+	target := make([]string, len(conflict))
+	for i, col := range conflict {
+		target[i] = d.Quote(col)
+	}
+	s := " ON CONFLICT (" + strings.Join(target, ", ") + ")"
+	if len(update) == 0 {
+		return s + " DO NOTHING"
+	}
+	sets := make([]string, len(update))
+	for i, col := range update {
+		sets[i] = fmt.Sprintf("%v = EXCLUDED.%v", d.Quote(col), d.Quote(col))
+	}
+	return s + " DO UPDATE SET " + strings.Join(sets, ", ")
+}
+
+func limitOffset(limit, offset int, unlimited string) string {
+	s := ""
+	if limit >= 0 {
+		s = fmt.Sprintf(" LIMIT %v", limit)
+	} else if offset > 0 {
+		s = unlimited
+	}
+	if offset > 0 {
+		s = s + fmt.Sprintf(" OFFSET %v", offset)
+	}
+	return s
+}
+
+func insertValues(d Dialect, table string, columns []string) string {
+	names := make([]string, len(columns))
+	marks := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = d.Quote(col)
+		marks[i] = "?"
+	}
+	return fmt.Sprintf("INSERT INTO %v (%v) VALUES (%v)", table, strings.Join(names, ", "), strings.Join(marks, ", "))
+}
+
+// quoteWith quotes every part of a dotted name, "*" is left untouched.
+func quoteWith(name, q string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		if p == "*" {
+			continue
+		}
+		parts[i] = q + strings.Replace(p, q, q+q, -1) + q
+	}
+	return strings.Join(parts, ".")
+}
+
+// rebind rewrites the "?" placeholders of s into the dialect bind
+// variables, question marks inside quoted strings are kept.
+func rebind(d Dialect, s string) string {
+	if d.Placeholder(1) == "?" {
+		return s
+	}
+	var b strings.Builder
+	n := 0
+	var quote rune
+	for _, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteString(d.Placeholder(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,94 @@
+package orm
+
+import (
+	"strings"
+)
+
+// Expression is a raw SQL fragment, see Expr.
+type Expression struct {
+	sql  string
+	args []interface{}
+}
+
+// Expr returns a raw SQL fragment used in place of a bound argument,
+// in conditions, Values or struct fields, its own "?" take args:
+//
+//	m.Where("created < ?", orm.Expr("NOW()"))
+//	m.Where(orm.Values{"updated": orm.Expr("updated + ?", 1)})
+func Expr(sql string, args ...interface{}) Expression {
+	return Expression{sql: sql, args: args}
+}
+
+func (e Expression) String() string {
+	return e.sql
+}
+
+type union struct {
+	op    string
+	query *Model
+}
+
+// Union appends the query of the session sub with UNION, the ordering
+// and limit of the session apply to the whole result.
+func (m *Model) Union(sub *Model) *Model {
+	m = m.instance()
+	m.unions = append(m.unions, union{op: " UNION ", query: sub})
+	return m
+}
+
+func (m *Model) UnionAll(sub *Model) *Model {
+	m = m.instance()
+	m.unions = append(m.unions, union{op: " UNION ALL ", query: sub})
+	return m
+}
+
+// inline writes the Expression and *Model arguments of str into the
+// SQL, a *Model is rendered as a subquery in parentheses.
+func inline(str string, args []interface{}) (string, []interface{}) {
+	found := false
+	for _, arg := range args {
+		switch arg.(type) {
+		case Expression, *Expression, *Model:
+			found = true
+		}
+	}
+	if !found {
+		return str, args
+	}
+	var b strings.Builder
+	result := make([]interface{}, 0, len(args))
+	n := 0
+	var quote rune
+	for _, c := range str {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?' && n < len(args):
+			arg := args[n]
+			n++
+			if e, ok := arg.(*Expression); ok {
+				arg = *e
+			}
+			switch v := arg.(type) {
+			case Expression:
+				s, a := inline(v.sql, v.args)
+				b.WriteString(s)
+				result = append(result, a...)
+			case *Model:
+				s, a := inline(v.buildQuery())
+				b.WriteString("(" + s + ")")
+				result = append(result, a...)
+			default:
+				b.WriteRune(c)
+				result = append(result, arg)
+			}
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String(), append(result, args[n:]...)
+}
@@ -0,0 +1,119 @@
+package orm
+
+import (
+	"context"
+	"reflect"
+)
+
+// Hooks are optional methods of the struct passed to Insert, Update,
+// Delete, FindOne and FindAll. They receive a session of the current
+// transaction, if any. An error from a Before hook aborts the operation,
+// an error from an After hook is returned and rolls the operation back:
+// outside of a transaction one is opened for the statement and its hook.
+type BeforeInserter interface {
+	BeforeInsert(m *Model) error
+}
+
+type AfterInserter interface {
+	AfterInsert(m *Model) error
+}
+
+type BeforeUpdater interface {
+	BeforeUpdate(m *Model) error
+}
+
+type AfterUpdater interface {
+	AfterUpdate(m *Model) error
+}
+
+type BeforeDeleter interface {
+	BeforeDelete(m *Model) error
+}
+
+type AfterDeleter interface {
+	AfterDelete(m *Model) error
+}
+
+type AfterFinder interface {
+	AfterFind(m *Model) error
+}
+
+func (m *Model) beforeInsert(ctx context.Context, v interface{}) error {
+	if h, ok := v.(BeforeInserter); ok {
+		return h.BeforeInsert(m.hookModel(ctx))
+	}
+	return nil
+}
+
+func (m *Model) afterInsert(ctx context.Context, v interface{}) error {
+	if h, ok := v.(AfterInserter); ok {
+		return h.AfterInsert(m.hookModel(ctx))
+	}
+	return nil
+}
+
+func (m *Model) beforeUpdate(ctx context.Context, v interface{}) error {
+	if h, ok := v.(BeforeUpdater); ok {
+		return h.BeforeUpdate(m.hookModel(ctx))
+	}
+	return nil
+}
+
+func (m *Model) afterUpdate(ctx context.Context, v interface{}) error {
+	if h, ok := v.(AfterUpdater); ok {
+		return h.AfterUpdate(m.hookModel(ctx))
+	}
+	return nil
+}
+
+func (m *Model) beforeDelete(ctx context.Context, v interface{}) error {
+	if h, ok := v.(BeforeDeleter); ok {
+		return h.BeforeDelete(m.hookModel(ctx))
+	}
+	return nil
+}
+
+func (m *Model) afterDelete(ctx context.Context, v interface{}) error {
+	if h, ok := v.(AfterDeleter); ok {
+		return h.AfterDelete(m.hookModel(ctx))
+	}
+	return nil
+}
+
+// hookModel returns the session given to hooks, ctx is the context
+// the operation was given with WithContext, captured before the
+// statement reset the session.
+func (m *Model) hookModel(ctx context.Context) *Model {
+	s := m.Model()
+	s.ctx = ctx
+	return s
+}
+
+// hookTx runs op on the session m moved to a new transaction, so that
+// an error of the After hook called by op rolls the statement back.
+func (m *Model) hookTx(op func(s *Model) (int64, error)) (int64, error) {
+	defer m.flush()
+	var n int64
+	err := m.TransactionContext(m.context(), func(tx *Model) error {
+		s := *m
+		s.tx, s.txCtx, s.depth = tx.tx, tx.txCtx, tx.depth
+		var err error
+		n, err = op(&s)
+		m.lastSql, m.lastInsertId, m.affectedRows = s.lastSql, s.lastInsertId, s.affectedRows
+		return err
+	})
+	return n, err
+}
+
+// afterFind calls AfterFind on every record, addressable struct values.
+func (m *Model) afterFind(ctx context.Context, records []reflect.Value) error {
+	if len(records) == 0 || !reflect.PtrTo(records[0].Type()).Implements(reflect.TypeOf((*AfterFinder)(nil)).Elem()) {
+		return nil
+	}
+	for _, record := range records {
+		if err := record.Addr().Interface().(AfterFinder).AfterFind(m.hookModel(ctx)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
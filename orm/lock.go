@@ -0,0 +1,67 @@
+package orm
+
+import (
+	"fmt"
+	"reflect"
+)
+
+const (
+	VERSION_TAG = "version"
+)
+
+// ErrStaleObject is returned by Update when the row was changed or
+// deleted since v was read, its version no longer matches. Reload the
+// row and retry.
+type ErrStaleObject struct {
+	Table   string
+	Key     interface{}
+	Version int64
+}
+
+func (e *ErrStaleObject) Error() string {
+	return fmt.Sprintf("stale object: %v %v version %v was modified", e.Table, e.Key, e.Version)
+}
+
+// versionLock is the optimistic lock of one Update.
+type versionLock struct {
+	column string
+	field  reflect.Value
+	value  int64
+}
+
+// lockVersion finds the integer field of v tagged version, adds
+// "version = current" to the condition and stores current + 1 in
+// columns. It returns nil when v has no version field.
+func (m *Model) lockVersion(v reflect.Value, columns map[string]interface{}) (*versionLock, error) {
+	for column, index := range m.parse.taggedColumns(v.Type(), VERSION_TAG) {
+		field, err := v.FieldByIndexErr(index)
+		if err != nil {
+			return nil, err
+		}
+		lock := &versionLock{column: column, field: field}
+		switch field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			lock.value = field.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			lock.value = int64(field.Uint())
+		default:
+			return nil, fmt.Errorf("version column %v needs an integer field", column)
+		}
+		m.Where(Values{column: lock.value})
+		columns[column] = lock.value + 1
+		return lock, nil
+	}
+	return nil, nil
+}
+
+// commit writes the new version into the struct after a successful update.
+func (l *versionLock) commit() {
+	if !l.field.CanSet() {
+		return
+	}
+	if l.field.Kind() >= reflect.Uint && l.field.Kind() <= reflect.Uint64 {
+		l.field.SetUint(uint64(l.value + 1))
+	} else {
+		l.field.SetInt(l.value + 1)
+	}
+}
@@ -0,0 +1,156 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type LogLevel int
+
+const (
+	LOG_SILENT LogLevel = iota
+	LOG_ERROR
+	LOG_WARN
+	LOG_INFO
+)
+
+// QueryEvent describes one statement sent to the database.
+// RowsAffected is -1 for queries returning rows.
+type QueryEvent struct {
+	Sql          string
+	Args         []interface{}
+	Start        time.Time
+	Elapsed      time.Duration
+	RowsAffected int64
+	Err          error
+}
+
+// QueryHook is called around every statement, the context returned by
+// BeforeQuery is used to run it, for example to carry a tracing span.
+type QueryHook interface {
+	BeforeQuery(ctx context.Context, e *QueryEvent) context.Context
+	AfterQuery(ctx context.Context, e *QueryEvent)
+}
+
+type Logger interface {
+	LogQuery(ctx context.Context, e *QueryEvent)
+}
+
+// StdLogger writes statements to a standard logger. Errors are logged
+// from LOG_ERROR, statements slower than SlowThreshold from LOG_WARN
+// and every statement at LOG_INFO. Redact hides the argument values.
+type StdLogger struct {
+	Logger        *log.Logger
+	Level         LogLevel
+	SlowThreshold time.Duration
+	Redact        bool
+}
+
+// NewLogger returns a StdLogger on l, the standard logger when l is nil.
+// Argument values are redacted, clear Redact to log them.
+func NewLogger(l *log.Logger, level LogLevel) *StdLogger {
+	if l == nil {
+		l = log.Default()
+	}
+	return &StdLogger{
+		Logger:        l,
+		Level:         level,
+		SlowThreshold: 200 * time.Millisecond,
+		Redact:        true,
+	}
+}
+
+func (l *StdLogger) LogQuery(ctx context.Context, e *QueryEvent) {
+	slow := l.SlowThreshold > 0 && e.Elapsed >= l.SlowThreshold
+	switch {
+	case e.Err != nil && l.Level >= LOG_ERROR:
+		l.Logger.Printf("[error] %v [%v] %v %v", e.Sql, e.Elapsed, l.args(e.Args), e.Err)
+	case e.Err == nil && slow && l.Level >= LOG_WARN:
+		l.Logger.Printf("[slow] %v [%v] %v", e.Sql, e.Elapsed, l.args(e.Args))
+	case e.Err == nil && l.Level >= LOG_INFO:
+		l.Logger.Printf("%v [%v] %v rows:%v", e.Sql, e.Elapsed, l.args(e.Args), e.RowsAffected)
+	}
+}
+
+func (l *StdLogger) args(args []interface{}) string {
+	if len(args) == 0 {
+		return "[]"
+	}
+	values := make([]string, len(args))
+	for i, arg := range args {
+		if l.Redact {
+			values[i] = "?"
+		} else {
+			values[i] = fmt.Sprintf("%v", arg)
+		}
+	}
+	return "[" + strings.Join(values, ", ") + "]"
+}
+
+// SetLogger replaces the logger of the root model and its sessions,
+// nil, typed nil pointers included, disables logging. Call it before
+// the model is shared, it panics on a session or transaction.
+func (m *Model) SetLogger(l Logger) *Model {
+	m.root("SetLogger")
+	if v := reflect.ValueOf(l); l != nil && v.Kind() == reflect.Ptr && v.IsNil() {
+		l = nil
+	}
+	m.logger = l
+	return m
+}
+
+// AddHook registers h on the root model and its sessions. Call it
+// before the model is shared, it panics on a session or transaction.
+func (m *Model) AddHook(h QueryHook) *Model {
+	m.root("AddHook")
+	m.hooks = append(m.hooks, h)
+	return m
+}
+
+// trace runs fn, which returns the affected rows, between the query
+// hooks and logs the statement.
+func (m *Model) trace(str string, args []interface{}, fn func(ctx context.Context) (int64, error)) error {
+	ctx, e := m.traceStart(str, args)
+	if e == nil {
+		_, err := fn(ctx)
+		return err
+	}
+	e.RowsAffected, e.Err = fn(ctx)
+	m.traceEnd(ctx, e)
+	return e.Err
+}
+
+// traceStart calls the BeforeQuery hooks, the event is nil when
+// there is neither hook nor logger.
+func (m *Model) traceStart(str string, args []interface{}) (context.Context, *QueryEvent) {
+	ctx := m.context()
+	if m.logger == nil && len(m.hooks) == 0 {
+		return ctx, nil
+	}
+	e := &QueryEvent{
+		Sql:   str,
+		Args:  args,
+		Start: time.Now(),
+	}
+	for _, h := range m.hooks {
+		ctx = h.BeforeQuery(ctx, e)
+	}
+	return ctx, e
+}
+
+func (m *Model) traceEnd(ctx context.Context, e *QueryEvent) {
+	if e == nil {
+		return
+	}
+	e.Elapsed = time.Since(e.Start)
+	for _, h := range m.hooks {
+		h.AfterQuery(ctx, e)
+	}
+	if m.logger != nil {
+		m.logger.LogQuery(ctx, e)
+	}
+}
@@ -0,0 +1,304 @@
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"loso/orm"
+)
+
+const (
+	VERSION_TABLE = "schema_migrations"
+)
+
+var (
+	fileRegex = regexp.MustCompile(`^(\d+)_(.*)\.(up|down)\.sql$`)
+)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// version is a row of the versions table.
+type version struct {
+	Version   int64     `db:"pk"`
+	Name      string    `db:"type:varchar(255)"`
+	AppliedAt time.Time `db:"field:applied_at"`
+}
+
+type Migrator struct {
+	model      *orm.Model
+	table      string
+	migrations map[int64]*Migration
+}
+
+func New(m *orm.Model) *Migrator {
+	return &Migrator{
+		model:      m,
+		table:      VERSION_TABLE,
+		migrations: make(map[int64]*Migration),
+	}
+}
+
+// Table changes the name of the versions table.
+func (mg *Migrator) Table(name string) *Migrator {
+	mg.table = name
+	return mg
+}
+
+func (mg *Migrator) Add(migration Migration) *Migrator {
+	mg.migrations[migration.Version] = &migration
+	return mg
+}
+
+// Load reads the migration files of fsys, named
+// <version>_<name>.up.sql and <version>_<name>.down.sql.
+func (mg *Migrator) Load(fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		match := fileRegex.FindStringSubmatch(file)
+		if match == nil {
+			continue
+		}
+		v, _ := strconv.ParseInt(match[1], 10, 64)
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		migration, ok := mg.migrations[v]
+		if !ok {
+			migration = &Migration{Version: v, Name: match[2]}
+			mg.migrations[v] = migration
+		}
+		if match[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+	return nil
+}
+
+// Applied returns the applied versions in ascending order.
+func (mg *Migrator) Applied() ([]int64, error) {
+	if err := mg.init(); err != nil {
+		return nil, err
+	}
+	rows := make([]version, 0)
+	if err := mg.model.UsePrimary().Table(mg.table).OrderBy("version").FindAll(&rows); err != nil {
+		return nil, err
+	}
+	versions := make([]int64, len(rows))
+	for i, row := range rows {
+		versions[i] = row.Version
+	}
+	return versions, nil
+}
+
+// Up applies every pending migration in version order,
+// each one in its own transaction.
+func (mg *Migrator) Up() error {
+	applied, err := mg.Applied()
+	if err != nil {
+		return err
+	}
+	done := make(map[int64]bool)
+	for _, v := range applied {
+		done[v] = true
+	}
+	for _, migration := range mg.sorted() {
+		if done[migration.Version] {
+			continue
+		}
+		err := mg.model.Transaction(func(tx *orm.Model) error {
+			if err := execute(tx, migration.Up); err != nil {
+				return err
+			}
+			_, err := tx.Table(mg.table).Insert(&version{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			})
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d %v: %v", migration.Version, migration.Name, err)
+		}
+	}
+	return nil
+}
+
+// Down reverts the last steps applied migrations.
+func (mg *Migrator) Down(steps int) error {
+	applied, err := mg.Applied()
+	if err != nil {
+		return err
+	}
+	for i := len(applied) - 1; i >= 0 && steps > 0; i, steps = i-1, steps-1 {
+		migration, ok := mg.migrations[applied[i]]
+		if !ok {
+			return fmt.Errorf("migration %d not found", applied[i])
+		}
+		err := mg.model.Transaction(func(tx *orm.Model) error {
+			if err := execute(tx, migration.Down); err != nil {
+				return err
+			}
+			_, err := tx.Table(mg.table).Where("version = ?", migration.Version).Delete(nil)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d %v: %v", migration.Version, migration.Name, err)
+		}
+	}
+	return nil
+}
+
+// AutoMigrate creates the table of every struct and adds the
+// columns missing from existing tables. Columns are never dropped.
+func (mg *Migrator) AutoMigrate(values ...interface{}) error {
+	d := mg.model.Dialect()
+	parser := mg.model.Parser()
+	for _, v := range values {
+		table := parser.TableName(reflect.TypeOf(v))
+		columns, err := mg.columns(table)
+		stmts := make([]string, 0)
+		if err != nil {
+			if stmts, err = CreateTable(d, parser, table, v); err != nil {
+				return err
+			}
+		} else {
+			for _, f := range parser.Fields(reflect.TypeOf(v)) {
+				if columns[f.Name] {
+					continue
+				}
+				add, err := AddColumn(d, table, f)
+				if err != nil {
+					return err
+				}
+				stmts = append(stmts, add...)
+			}
+		}
+		for _, s := range stmts {
+			if _, err := mg.model.Execute(s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// columns returns the column names of table, an error
+// usually means the table does not exist.
+func (mg *Migrator) columns(table string) (map[string]bool, error) {
+	rows, err := mg.model.DB().Query(fmt.Sprintf("SELECT * FROM %v WHERE 1 = 0", mg.model.Dialect().Quote(table)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]bool)
+	for _, name := range names {
+		columns[name] = true
+	}
+	return columns, nil
+}
+
+func (mg *Migrator) init() error {
+	stmts, err := CreateTable(mg.model.Dialect(), mg.model.Parser(), mg.table, version{})
+	if err != nil {
+		return err
+	}
+	for _, s := range stmts {
+		if _, err := mg.model.Execute(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mg *Migrator) sorted() []*Migration {
+	list := make([]*Migration, 0, len(mg.migrations))
+	for _, migration := range mg.migrations {
+		list = append(list, migration)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+	return list
+}
+
+func execute(m *orm.Model, script string) error {
+	for _, s := range split(script) {
+		if _, err := m.ExecRaw(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dollarQuote matches the opening tag of a PostgreSQL $$ or $tag$ body.
+var dollarQuote = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// split cuts a script into statements on the semicolons outside of
+// quotes, PostgreSQL dollar quoted bodies and comments. "--" comments
+// are dropped, /* */ comments are kept.
+func split(script string) []string {
+	stmts := make([]string, 0)
+	var b strings.Builder
+	for i := 0; i < len(script); {
+		end := i + 1
+		switch c := script[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			end = closing(script, i+1, string(c))
+		case strings.HasPrefix(script[i:], "--"):
+			if n := strings.IndexByte(script[i:], '\n'); n >= 0 {
+				i += n
+			} else {
+				i = len(script)
+			}
+			continue
+		case strings.HasPrefix(script[i:], "/*"):
+			end = closing(script, i+2, "*/")
+		case c == '$' && dollarQuote.MatchString(script[i:]):
+			tag := dollarQuote.FindString(script[i:])
+			end = closing(script, i+len(tag), tag)
+		case c == ';':
+			if s := strings.TrimSpace(b.String()); s != "" {
+				stmts = append(stmts, s)
+			}
+			b.Reset()
+			i++
+			continue
+		}
+		b.WriteString(script[i:end])
+		i = end
+	}
+	if s := strings.TrimSpace(b.String()); s != "" {
+		stmts = append(stmts, s)
+	}
+	return stmts
+}
+
+// closing returns the index after the first delim of script from
+// start, the end of script when there is none.
+func closing(script string, start int, delim string) int {
+	if n := strings.Index(script[start:], delim); n >= 0 {
+		return start + n + len(delim)
+	}
+	return len(script)
+}
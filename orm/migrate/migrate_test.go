@@ -0,0 +1,42 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"single", "SELECT 1;", []string{"SELECT 1"}},
+		{"several", "SELECT 1; SELECT 2;\nSELECT 3;", []string{"SELECT 1", "SELECT 2", "SELECT 3"}},
+		{"no trailing semicolon", "SELECT 1;\nSELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"empty statements", ";;\n SELECT 1;; ;", []string{"SELECT 1"}},
+		{"empty", " \n\t", []string{}},
+		{"single quotes", "INSERT INTO t VALUES ('a;b'); SELECT 1", []string{"INSERT INTO t VALUES ('a;b')", "SELECT 1"}},
+		{"escaped quote", "INSERT INTO t VALUES ('it''s;'); SELECT 1", []string{"INSERT INTO t VALUES ('it''s;')", "SELECT 1"}},
+		{"double quotes", `SELECT "a;b" FROM t; SELECT 1`, []string{`SELECT "a;b" FROM t`, "SELECT 1"}},
+		{"backquotes", "SELECT `a;b` FROM t; SELECT 1", []string{"SELECT `a;b` FROM t", "SELECT 1"}},
+		{"unterminated quote", "SELECT 'a;b", []string{"SELECT 'a;b"}},
+		{"line comment", "-- create t; drop t\nCREATE TABLE t (id INT); -- done;\nSELECT 1",
+			[]string{"CREATE TABLE t (id INT)", "SELECT 1"}},
+		{"line comment at the end", "SELECT 1; -- last;", []string{"SELECT 1"}},
+		{"dashes in a string", "SELECT '--;'; SELECT 1", []string{"SELECT '--;'", "SELECT 1"}},
+		{"block comment", "/* a; b */ SELECT 1; SELECT /* ; */ 2",
+			[]string{"/* a; b */ SELECT 1", "SELECT /* ; */ 2"}},
+		{"unterminated block comment", "SELECT 1; /* a; b", []string{"SELECT 1", "/* a; b"}},
+		{"dollar body", "CREATE FUNCTION f() RETURNS INT AS $$ BEGIN RETURN 1; END $$ LANGUAGE plpgsql; SELECT 1",
+			[]string{"CREATE FUNCTION f() RETURNS INT AS $$ BEGIN RETURN 1; END $$ LANGUAGE plpgsql", "SELECT 1"}},
+		{"tagged dollar body", "DO $body$ BEGIN PERFORM 'x$$;'; END $body$; SELECT 1",
+			[]string{"DO $body$ BEGIN PERFORM 'x$$;'; END $body$", "SELECT 1"}},
+		{"bind variables", "UPDATE t SET a = $1; UPDATE t SET b = $2", []string{"UPDATE t SET a = $1", "UPDATE t SET b = $2"}},
+	}
+	for _, tt := range tests {
+		if got := split(tt.script); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: split(%q) = %q, want %q", tt.name, tt.script, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"loso/orm"
+)
+
+var (
+	NO_COLUMNS = errors.New("struct has no columns")
+)
+
+// CreateTable returns the statements creating the table of struct v
+// from its db tags, for example:
+//
+//	Name string `db:"type:varchar(64);null;default:'';comment:user name"`
+//
+// Pass the parser of the model, see Model.Parser, to reuse its cached
+// schemas, nil parses v with a new one.
+func CreateTable(d orm.Dialect, parser *orm.Parser, table string, v interface{}) ([]string, error) {
+	if parser == nil {
+		parser = &orm.Parser{}
+	}
+	t := reflect.TypeOf(v)
+	if table == "" {
+		table = parser.TableName(t)
+	}
+	fields := parser.Fields(t)
+	if len(fields) == 0 {
+		return nil, NO_COLUMNS
+	}
+	columns := make([]string, 0, len(fields)+1)
+	pks := make([]string, 0)
+	for _, f := range fields {
+		def, err := ColumnDefinition(d, f)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, "  "+def)
+		if f.PrimaryKey && !inlinePrimaryKey(d, f) {
+			pks = append(pks, d.Quote(f.Name))
+		}
+	}
+	if len(pks) > 0 {
+		columns = append(columns, "  PRIMARY KEY ("+strings.Join(pks, ", ")+")")
+	}
+	stmts := []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v (\n%v\n)", d.Quote(table), strings.Join(columns, ",\n"))}
+	return append(stmts, comments(d, table, fields)...), nil
+}
+
+// AddColumn returns the statements adding column f to table.
+func AddColumn(d orm.Dialect, table string, f orm.Field) ([]string, error) {
+	def, err := ColumnDefinition(d, f)
+	if err != nil {
+		return nil, err
+	}
+	stmts := []string{fmt.Sprintf("ALTER TABLE %v ADD COLUMN %v", d.Quote(table), def)}
+	return append(stmts, comments(d, table, []orm.Field{f})...), nil
+}
+
+// ColumnDefinition returns the column clause of f, the SQL type is
+// taken from the type tag or derived from the Go type. The column is
+// nullable when the null tag is set or the Go type can hold NULL.
+func ColumnDefinition(d orm.Dialect, f orm.Field) (string, error) {
+	typ := f.Type
+	null := f.Null || nullable(f)
+	if typ == "" {
+		var err error
+		if typ, err = columnType(d, f); err != nil {
+			return "", err
+		}
+	}
+	s := d.Quote(f.Name) + " " + typ
+	if inlinePrimaryKey(d, f) {
+		return s + " PRIMARY KEY AUTOINCREMENT", nil
+	}
+	if !null || f.PrimaryKey {
+		s += " NOT NULL"
+	} else {
+		s += " NULL"
+	}
+	if f.AutoIncrement && d.Name() == "mysql" {
+		s += " AUTO_INCREMENT"
+	}
+	if f.Default != "" {
+		s += " DEFAULT " + f.Default
+	}
+	if f.Comment != "" && d.Name() == "mysql" {
+		s += " COMMENT " + quoteString(f.Comment)
+	}
+	return s, nil
+}
+
+// inlinePrimaryKey reports whether f is a SQLite AUTOINCREMENT key,
+// which must be declared on the column itself.
+func inlinePrimaryKey(d orm.Dialect, f orm.Field) bool {
+	return d.Name() == "sqlite" && f.PrimaryKey && f.AutoIncrement
+}
+
+// comments returns the COMMENT ON statements PostgreSQL needs.
+func comments(d orm.Dialect, table string, fields []orm.Field) []string {
+	stmts := make([]string, 0)
+	if d.Name() != "postgres" {
+		return stmts
+	}
+	for _, f := range fields {
+		if f.Comment != "" {
+			stmts = append(stmts, fmt.Sprintf("COMMENT ON COLUMN %v IS %v", d.Quote(table+"."+f.Name), quoteString(f.Comment)))
+		}
+	}
+	return stmts
+}
+
+var (
+	timeType   = reflect.TypeOf(time.Time{})
+	bytesType  = reflect.TypeOf([]byte{})
+	nullValues = map[reflect.Type]reflect.Type{
+		reflect.TypeOf(sql.NullString{}):  reflect.TypeOf(""),
+		reflect.TypeOf(sql.NullInt64{}):   reflect.TypeOf(int64(0)),
+		reflect.TypeOf(sql.NullInt32{}):   reflect.TypeOf(int32(0)),
+		reflect.TypeOf(sql.NullInt16{}):   reflect.TypeOf(int16(0)),
+		reflect.TypeOf(sql.NullByte{}):    reflect.TypeOf(uint8(0)),
+		reflect.TypeOf(sql.NullFloat64{}): reflect.TypeOf(float64(0)),
+		reflect.TypeOf(sql.NullBool{}):    reflect.TypeOf(false),
+		reflect.TypeOf(sql.NullTime{}):    timeType,
+	}
+)
+
+// nullable reports whether the Go type of f can hold NULL, pointers,
+// sql.Null* types and JSON columns can.
+func nullable(f orm.Field) bool {
+	t := f.GoType
+	if f.JSON || t.Kind() == reflect.Ptr {
+		return true
+	}
+	_, ok := nullValues[t]
+	return ok
+}
+
+// columnType maps the Go type of f to a SQL type of the dialect.
+func columnType(d orm.Dialect, f orm.Field) (string, error) {
+	t := f.GoType
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if v, ok := nullValues[t]; ok {
+		t = v
+	}
+	name := d.Name()
+	if f.JSON {
+		return "TEXT", nil
+	}
+	pick := func(mysql, postgres, sqlite string) string {
+		switch name {
+		case "postgres":
+			return postgres
+		case "sqlite":
+			return sqlite
+		}
+		return mysql
+	}
+	switch {
+	case t == timeType:
+		return pick("DATETIME", "TIMESTAMP", "DATETIME"), nil
+	case t == bytesType:
+		return pick("BLOB", "BYTEA", "BLOB"), nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return pick("TINYINT(1)", "BOOLEAN", "BOOLEAN"), nil
+	case reflect.Int8, reflect.Int16, reflect.Uint8:
+		return pick("SMALLINT", "SMALLINT", "INTEGER"), nil
+	case reflect.Int32, reflect.Uint16:
+		if f.AutoIncrement {
+			return pick("INT", "SERIAL", "INTEGER"), nil
+		}
+		return pick("INT", "INTEGER", "INTEGER"), nil
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		if f.AutoIncrement {
+			return pick("BIGINT", "BIGSERIAL", "INTEGER"), nil
+		}
+		return pick("BIGINT", "BIGINT", "INTEGER"), nil
+	case reflect.Float32:
+		return pick("FLOAT", "REAL", "REAL"), nil
+	case reflect.Float64:
+		return pick("DOUBLE", "DOUBLE PRECISION", "REAL"), nil
+	case reflect.String:
+		return pick("VARCHAR(255)", "VARCHAR(255)", "TEXT"), nil
+	}
+	return "", fmt.Errorf("column %v: no sql type for %v, set a type tag", f.Name, f.GoType)
+}
+
+func quoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
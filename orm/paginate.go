@@ -0,0 +1,112 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	DEFAULT_PER_PAGE = 20
+)
+
+type Page struct {
+	Items      interface{}
+	Total      int64
+	Page       int
+	PerPage    int
+	TotalPages int
+}
+
+// KeysetPage is a page of KeysetPaginate, Next is the cursor of the
+// following page and is nil on the last one.
+type KeysetPage struct {
+	Items   interface{}
+	PerPage int
+	Next    interface{}
+	HasMore bool
+}
+
+// Paginate fills dest, a pointer to a slice of structs, with the rows of
+// page, starting at 1, and counts the total rows of the same query.
+func (m *Model) Paginate(page, perPage int, dest interface{}) (*Page, error) {
+	m = m.instance()
+	refValue := reflect.Indirect(reflect.ValueOf(dest))
+	if refValue.Kind() != reflect.Slice || !refValue.CanSet() {
+		return nil, errors.New("needs a pointer to a slice")
+	}
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = DEFAULT_PER_PAGE
+	}
+	m.bind(refValue.Type().Elem())
+	total, err := m.Session().count()
+	if err != nil {
+		return nil, err
+	}
+	refValue.SetLen(0)
+	if err := m.Limit((page-1)*perPage, perPage).FindAll(dest); err != nil {
+		return nil, err
+	}
+	return &Page{
+		Items:      refValue.Interface(),
+		Total:      total,
+		Page:       page,
+		PerPage:    perPage,
+		TotalPages: int((total + int64(perPage) - 1) / int64(perPage)),
+	}, nil
+}
+
+// KeysetPaginate fills dest with the perPage rows following the cursor
+// after, nil for the first page, ordered by column, an indexed unique
+// column optionally followed by DESC. Other orderings are replaced.
+func (m *Model) KeysetPaginate(column string, after interface{}, perPage int, dest interface{}) (*KeysetPage, error) {
+	m = m.instance()
+	refValue := reflect.Indirect(reflect.ValueOf(dest))
+	if refValue.Kind() != reflect.Slice || !refValue.CanSet() || refValue.Type().Elem().Kind() != reflect.Struct {
+		return nil, errors.New("needs a pointer to a slice of structs")
+	}
+	if perPage < 1 {
+		perPage = DEFAULT_PER_PAGE
+	}
+	parts := strings.Fields(column)
+	if len(parts) == 0 {
+		return nil, errors.New("keyset column required")
+	}
+	column = parts[0]
+	desc := len(parts) > 1 && strings.EqualFold(parts[1], "DESC")
+	elem := refValue.Type().Elem()
+	name := column[strings.LastIndex(column, ".")+1:]
+	index, ok := m.parse.Columns(elem)[name]
+	if !ok {
+		return nil, fmt.Errorf("%v has no column %v", elem.Name(), name)
+	}
+	if after != nil {
+		if desc {
+			m.Where(quoteIdent(m.dialect, column)+" < ?", after)
+		} else {
+			m.Where(quoteIdent(m.dialect, column)+" > ?", after)
+		}
+	}
+	m.orderBy, m.sorts = "", nil
+	if desc {
+		m.OrderBy(column, "DESC")
+	} else {
+		m.OrderBy(column, "ASC")
+	}
+	refValue.SetLen(0)
+	if err := m.Limit(perPage + 1).FindAll(dest); err != nil {
+		return nil, err
+	}
+	result := &KeysetPage{PerPage: perPage}
+	if refValue.Len() > perPage {
+		refValue.SetLen(perPage)
+		result.HasMore = true
+		result.Next = refValue.Index(perPage - 1).FieldByIndex(index).Interface()
+	}
+	result.Items = refValue.Interface()
+	return result, nil
+}
@@ -0,0 +1,132 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	INVALID_COLUMN    = errors.New("invalid column")
+	INVALID_DIRECTION = errors.New("invalid sort direction")
+
+	identPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\.[A-Za-z_][A-Za-z0-9_$]*)*(\.\*)?$`)
+
+	// keywords look like identifiers but must not be quoted
+	keywords = map[string]bool{
+		"NULL": true, "TRUE": true, "FALSE": true, "DEFAULT": true,
+		"CURRENT_DATE": true, "CURRENT_TIME": true, "CURRENT_TIMESTAMP": true,
+		"DISTINCT": true, "DISTINCTROW": true, "ALL": true, "NOT": true,
+		"CASE": true, "EXISTS": true, "INTERVAL": true, "AS": true,
+	}
+
+	// modifiers may prefix a selected column: "DISTINCT name"
+	modifiers = map[string]bool{
+		"DISTINCT": true, "DISTINCTROW": true, "ALL": true,
+	}
+)
+
+// isIdent reports whether s is a plain, optionally dotted, identifier.
+func isIdent(s string) bool {
+	return identPattern.MatchString(s) && !keywords[strings.ToUpper(s)]
+}
+
+// quoteIdent quotes s when it is an identifier optionally followed by
+// an alias or by ASC / DESC: "name", "u.name n", "name AS n", "id DESC".
+// A leading DISTINCT or ALL is kept. Anything else is an expression
+// and returned unchanged.
+func quoteIdent(d Dialect, s string) string {
+	fields := strings.Fields(s)
+	if len(fields) > 1 && modifiers[strings.ToUpper(fields[0])] {
+		return strings.ToUpper(fields[0]) + " " + quoteIdent(d, strings.Join(fields[1:], " "))
+	}
+	switch {
+	case len(fields) == 0 || !isIdent(fields[0]):
+		return strings.TrimSpace(s)
+	case len(fields) == 1:
+		return d.Quote(fields[0])
+	case len(fields) == 2 && isDirection(fields[1]):
+		return d.Quote(fields[0]) + " " + strings.ToUpper(fields[1])
+	case len(fields) == 2 && isIdent(fields[1]):
+		return d.Quote(fields[0]) + " " + d.Quote(fields[1])
+	case len(fields) == 3 && strings.EqualFold(fields[1], "AS") && isIdent(fields[2]):
+		return d.Quote(fields[0]) + " AS " + d.Quote(fields[2])
+	}
+	return strings.TrimSpace(s)
+}
+
+// quoteList quotes every item of a comma separated list, commas
+// inside parentheses or quotes do not split.
+func quoteList(d Dialect, s string) string {
+	items := splitList(s)
+	for i, item := range items {
+		items[i] = quoteIdent(d, item)
+	}
+	return strings.Join(items, ", ")
+}
+
+func splitList(s string) []string {
+	items := make([]string, 0)
+	depth, start := 0, 0
+	var quote rune
+	for i, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
+
+// isDistinct reports whether the column list s starts with DISTINCT
+// or DISTINCTROW.
+func isDistinct(s string) bool {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return false
+	}
+	first := strings.ToUpper(fields[0])
+	return first == "DISTINCT" || first == "DISTINCTROW"
+}
+
+func isDirection(s string) bool {
+	s = strings.ToUpper(s)
+	return s == "ASC" || s == "DESC"
+}
+
+// checkSorts validates the columns given to OrderBy with a direction
+// against the columns of the bound struct, or requires plain
+// identifiers when there is none.
+func (m *Model) checkSorts() error {
+	if m.err != nil {
+		return m.err
+	}
+	var columns map[string][]int
+	if m.model != nil {
+		columns = m.parse.Columns(m.model)
+	}
+	for _, column := range m.sorts {
+		if !isIdent(column) || strings.HasSuffix(column, "*") {
+			return fmt.Errorf("%w: %q", INVALID_COLUMN, column)
+		}
+		if columns == nil {
+			continue
+		}
+		if _, ok := columns[column[strings.LastIndex(column, ".")+1:]]; !ok {
+			return fmt.Errorf("%w: %v has no column %q", INVALID_COLUMN, m.model.Name(), column)
+		}
+	}
+	return nil
+}
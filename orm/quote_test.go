@@ -0,0 +1,127 @@
+package orm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestQuoteIdent(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"name", `"name"`},
+		{"  name  ", `"name"`},
+		{"u.name", `"u"."name"`},
+		{"t.*", `"t".*`},
+		{"*", "*"},
+		{"u.name n", `"u"."name" "n"`},
+		{"name AS n", `"name" AS "n"`},
+		{"name as n", `"name" AS "n"`},
+		{"id DESC", `"id" DESC`},
+		{"id asc", `"id" ASC`},
+		{"DISTINCT name", `DISTINCT "name"`},
+		{"distinct u.name AS n", `DISTINCT "u"."name" AS "n"`},
+		{"NULL", "NULL"},
+		{"null", "null"},
+		{"CURRENT_TIMESTAMP", "CURRENT_TIMESTAMP"},
+		{"COUNT(*)", "COUNT(*)"},
+		{"COUNT(id) AS total", "COUNT(id) AS total"},
+		{"name + 1", "name + 1"},
+		{"'literal'", "'literal'"},
+		{"name AS", "name AS"},
+		{"name n extra", "name n extra"},
+		{`na"me`, `na"me`},
+		{"id; DROP TABLE users", "id; DROP TABLE users"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := quoteIdent(SQLite{}, tt.in); got != tt.want {
+			t.Errorf("quoteIdent(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"id", []string{"id"}},
+		{"id, name", []string{"id", " name"}},
+		{"COALESCE(a, b), c", []string{"COALESCE(a, b)", " c"}},
+		{"CONCAT(a, LOWER(b, c)), d", []string{"CONCAT(a, LOWER(b, c))", " d"}},
+		{"'a,b', c", []string{"'a,b'", " c"}},
+		{`"a,b", c`, []string{`"a,b"`, " c"}},
+		{"`a,b`, c", []string{"`a,b`", " c"}},
+		{"'(', d", []string{"'('", " d"}},
+		{"", []string{""}},
+	}
+	for _, tt := range tests {
+		if got := splitList(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitList(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteList(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"id, name", `"id", "name"`},
+		{"u.*, p.title t", `"u".*, "p"."title" "t"`},
+		{"COALESCE(a, b) AS c, d", `COALESCE(a, b) AS c, "d"`},
+		{"'a, b', c", `'a, b', "c"`},
+		{"DISTINCT name, age", `DISTINCT "name", "age"`},
+		{"id DESC, name", `"id" DESC, "name"`},
+	}
+	for _, tt := range tests {
+		if got := quoteList(SQLite{}, tt.in); got != tt.want {
+			t.Errorf("quoteList(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestOrderByDirection(t *testing.T) {
+	type user struct {
+		Id   int64  `db:"field:id;pk;auto"`
+		Name string `db:"field:name"`
+	}
+	tests := []struct {
+		model     interface{}
+		column    string
+		direction string
+		order     string
+		err       error
+	}{
+		{nil, "name", "asc", ` ORDER BY "name" ASC`, nil},
+		{nil, "u.name", "DESC", ` ORDER BY "u"."name" DESC`, nil},
+		{&user{}, "name", "DESC", ` ORDER BY "name" DESC`, nil},
+		{&user{}, "u.name", "DESC", ` ORDER BY "u"."name" DESC`, nil},
+		{nil, "name", "DESC; DROP TABLE users", "", INVALID_DIRECTION},
+		{nil, "name", "DESC --", "", INVALID_DIRECTION},
+		{nil, "name", "", "", INVALID_DIRECTION},
+		{nil, "id; DROP TABLE users", "ASC", "", INVALID_COLUMN},
+		{nil, "id) --", "ASC", "", INVALID_COLUMN},
+		{nil, "(SELECT 1)", "ASC", "", INVALID_COLUMN},
+		{nil, "t.*", "ASC", "", INVALID_COLUMN},
+		{nil, "NULL", "ASC", "", INVALID_COLUMN},
+		{&user{}, "password", "ASC", "", INVALID_COLUMN},
+	}
+	root := New(nil, SQLite{})
+	for _, tt := range tests {
+		m := root.Model()
+		if tt.model != nil {
+			m = root.Model(tt.model)
+		}
+		m = m.OrderBy(tt.column, tt.direction)
+		err := m.checkSorts()
+		if !errors.Is(err, tt.err) {
+			t.Errorf("OrderBy(%q, %q) error = %v, want %v", tt.column, tt.direction, err, tt.err)
+			continue
+		}
+		if tt.err == nil && m.orderBy != tt.order {
+			t.Errorf("OrderBy(%q, %q) = %q, want %q", tt.column, tt.direction, m.orderBy, tt.order)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	REL_TAG  = "rel"
+	FK_TAG   = "fk"
+	REF_TAG  = "ref"
+	KEY_TAG  = "key"
+	JOIN_TAG = "join"
+
+	HAS_ONE      = "has_one"
+	HAS_MANY     = "has_many"
+	BELONGS_TO   = "belongs_to"
+	MANY_TO_MANY = "many_to_many"
+)
+
+// relation describes a field declared with a rel tag:
+//
+//	Profile Profile  `db:"rel:has_one;fk:user_id"`
+//	Orders  []Order  `db:"rel:has_many;fk:user_id"`
+//	Company *Company `db:"rel:belongs_to;fk:company_id"`
+//	Roles   []Role   `db:"rel:many_to_many;join:user_roles;fk:user_id;ref:role_id"`
+//
+// fk is the foreign key column, on the related table for has_one and
+// has_many, on the owner for belongs_to and on the join table for
+// many_to_many where ref points to the related table. key overrides the
+// referenced column, the primary key by default.
+type relation struct {
+	kind  string
+	field reflect.StructField
+	elem  reflect.Type
+	fk    string
+	ref   string
+	key   string
+	join  string
+}
+
+// Preload loads the named relation fields after FindOne or FindAll with
+// one IN query per relation, nested relations are separated by dots:
+// Preload("Orders", "Orders.Items").
+func (m *Model) Preload(names ...string) *Model {
+	m = m.instance()
+	m.preloads = append(m.preloads, names...)
+	return m
+}
+
+func (p *Parser) relation(t reflect.Type, name string) (*relation, error) {
+	field, ok := t.FieldByName(name)
+	if !ok {
+		return nil, fmt.Errorf("%v has no field %v", t.Name(), name)
+	}
+	tag := tagOf(field)
+	if !tag.Has(REL_TAG) {
+		return nil, fmt.Errorf("%v.%v has no rel tag", t.Name(), name)
+	}
+	rel := &relation{
+		kind:  tag.Get(REL_TAG),
+		field: field,
+		elem:  field.Type,
+		fk:    tag.Get(FK_TAG),
+		ref:   tag.Get(REF_TAG),
+		key:   tag.Get(KEY_TAG),
+		join:  tag.Get(JOIN_TAG),
+	}
+	if rel.elem.Kind() == reflect.Slice {
+		rel.elem = rel.elem.Elem()
+	}
+	if rel.elem.Kind() == reflect.Ptr {
+		rel.elem = rel.elem.Elem()
+	}
+	if rel.elem.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%v.%v is not a struct relation", t.Name(), name)
+	}
+	switch rel.kind {
+	case HAS_ONE, HAS_MANY, BELONGS_TO:
+	case MANY_TO_MANY:
+		if rel.join == "" || rel.ref == "" {
+			return nil, fmt.Errorf("%v.%v needs join and ref", t.Name(), name)
+		}
+	default:
+		return nil, fmt.Errorf("%v.%v unknown relation %v", t.Name(), name, rel.kind)
+	}
+	if rel.fk == "" {
+		return nil, fmt.Errorf("%v.%v needs fk", t.Name(), name)
+	}
+	return rel, nil
+}
+
+// preload fills the relations named by paths on records,
+// a list of addressable struct values of the same type. The
+// queries are sessions derived from m, which is never run.
+func (m *Model) preload(records []reflect.Value, paths []string) error {
+	if len(records) == 0 || len(paths) == 0 {
+		return nil
+	}
+	names := make([]string, 0)
+	nested := make(map[string][]string)
+	for _, path := range paths {
+		parts := strings.SplitN(path, ".", 2)
+		if _, ok := nested[parts[0]]; !ok {
+			names = append(names, parts[0])
+			nested[parts[0]] = make([]string, 0)
+		}
+		if len(parts) > 1 {
+			nested[parts[0]] = append(nested[parts[0]], parts[1])
+		}
+	}
+	for _, name := range names {
+		rel, err := m.parse.relation(records[0].Type(), name)
+		if err != nil {
+			return err
+		}
+		if err := m.loadRelation(records, rel, nested[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Model) loadRelation(records []reflect.Value, rel *relation, nested []string) error {
+	owner := records[0].Type()
+	// ownerKey is the owner column matched against relatedKey
+	ownerKey, _ := m.parse.ScanPk(records[0])
+	relatedKey := rel.key
+	if relatedKey == "" {
+		relatedKey, _ = m.parse.ScanPk(reflect.New(rel.elem).Elem())
+	}
+	switch rel.kind {
+	case HAS_ONE, HAS_MANY:
+		if rel.key != "" {
+			ownerKey = rel.key
+		}
+		relatedKey = rel.fk
+	case BELONGS_TO:
+		ownerKey = rel.fk
+	}
+	ownerIndex, ok := m.parse.Columns(owner)[ownerKey]
+	if !ok {
+		return fmt.Errorf("%v has no column %v", owner.Name(), ownerKey)
+	}
+	relatedIndex, ok := m.parse.Columns(rel.elem)[relatedKey]
+	if !ok {
+		return fmt.Errorf("%v has no column %v", rel.elem.Name(), relatedKey)
+	}
+
+	keys := make([]interface{}, 0, len(records))
+	seen := make(map[string]bool)
+	for _, record := range records {
+		if k, ok := keyOf(fieldByIndex(record, ownerIndex)); ok && !seen[fmt.Sprint(k)] {
+			seen[fmt.Sprint(k)] = true
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	// links maps an owner key to the related keys of a join table
+	var links map[string][]string
+	relatedKeys := keys
+	if rel.kind == MANY_TO_MANY {
+		rows, err := m.derive().Table(rel.join).Select(rel.fk+", "+rel.ref).WhereIn(rel.fk, keys).QueryAll()
+		if err != nil {
+			return err
+		}
+		links = make(map[string][]string)
+		relatedKeys = make([]interface{}, 0, len(rows))
+		seen = make(map[string]bool)
+		for _, row := range rows {
+			from, to := string(row[rel.fk]), string(row[rel.ref])
+			links[from] = append(links[from], to)
+			if !seen[to] {
+				seen[to] = true
+				relatedKeys = append(relatedKeys, to)
+			}
+		}
+		if len(relatedKeys) == 0 {
+			return nil
+		}
+	}
+
+	related := reflect.New(reflect.SliceOf(rel.elem))
+	if err := m.derive().Table(m.parse.TableName(rel.elem)).WhereIn(relatedKey, relatedKeys).FindAll(related.Interface()); err != nil {
+		return err
+	}
+	related = related.Elem()
+	values := make([]reflect.Value, related.Len())
+	for i := range values {
+		values[i] = related.Index(i)
+	}
+	if err := m.preload(values, nested); err != nil {
+		return err
+	}
+
+	byKey := make(map[string][]reflect.Value)
+	for _, v := range values {
+		if k, ok := keyOf(fieldByIndex(v, relatedIndex)); ok {
+			byKey[fmt.Sprint(k)] = append(byKey[fmt.Sprint(k)], v)
+		}
+	}
+	for _, record := range records {
+		k, ok := keyOf(fieldByIndex(record, ownerIndex))
+		if !ok {
+			continue
+		}
+		matches := byKey[fmt.Sprint(k)]
+		if links != nil {
+			matches = make([]reflect.Value, 0)
+			for _, to := range links[fmt.Sprint(k)] {
+				matches = append(matches, byKey[to]...)
+			}
+		}
+		if err := assign(record.FieldByIndex(rel.field.Index), matches); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keyOf returns the key value of field, false for nil or zero keys.
+func keyOf(field reflect.Value) (interface{}, bool) {
+	for field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return nil, false
+		}
+		field = field.Elem()
+	}
+	if field.IsZero() {
+		return nil, false
+	}
+	return field.Interface(), true
+}
+
+// assign stores matches in a struct, pointer or slice field.
+func assign(field reflect.Value, matches []reflect.Value) error {
+	t := field.Type()
+	switch {
+	case t.Kind() == reflect.Slice:
+		list := reflect.MakeSlice(t, 0, len(matches))
+		for _, v := range matches {
+			if t.Elem().Kind() == reflect.Ptr {
+				v = v.Addr()
+			}
+			list = reflect.Append(list, v)
+		}
+		field.Set(list)
+	case len(matches) == 0:
+	case t.Kind() == reflect.Ptr:
+		field.Set(matches[0].Addr())
+	case t.Kind() == reflect.Struct:
+		field.Set(matches[0])
+	default:
+		return errors.New("unsupport relation field " + t.String())
+	}
+	return nil
+}
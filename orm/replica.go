@@ -0,0 +1,59 @@
+package orm
+
+import (
+	"database/sql"
+	"math/rand"
+	"sync/atomic"
+)
+
+// Balancer picks which of n replicas serves the next read.
+type Balancer interface {
+	Pick(n int) int
+}
+
+// RoundRobin sends reads to the replicas in turn, it is the default.
+type RoundRobin struct {
+	next uint64
+}
+
+func (b *RoundRobin) Pick(n int) int {
+	return int((atomic.AddUint64(&b.next, 1) - 1) % uint64(n))
+}
+
+// Random sends every read to a random replica.
+type Random struct{}
+
+func (Random) Pick(n int) int {
+	return rand.Intn(n)
+}
+
+// SetBalancer sets how reads are spread over the replicas.
+// Call it before the model is shared, it panics on a session or
+// transaction.
+func (m *Model) SetBalancer(b Balancer) *Model {
+	m.root("SetBalancer")
+	m.balancer = b
+	return m
+}
+
+// Replicas returns the read replicas given to New.
+func (m *Model) Replicas() []*sql.DB {
+	return m.replicas
+}
+
+// UsePrimary sends the reads of the session to the primary, for
+// example to read back a row just written.
+func (m *Model) UsePrimary() *Model {
+	m = m.instance()
+	m.primary = true
+	return m
+}
+
+// reader returns the database serving a read: a replica unless the
+// model is in a transaction or UsePrimary is set.
+func (m *Model) reader() *sql.DB {
+	if m.tx != nil || m.primary || len(m.replicas) == 0 {
+		return m.db
+	}
+	return m.replicas[m.balancer.Pick(len(m.replicas))]
+}
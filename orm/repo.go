@@ -0,0 +1,141 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	RECORD_NOT_FOUND = errors.New("record not found")
+)
+
+// Repo is a typed access to the table of struct T:
+//
+//	users := orm.NewRepo[User](m)
+//	u, err := users.Find(1)
+//	list, err := users.List(orm.ListOptions{Cond: orm.NewCond().And("age > ?", 18), Limit: 10})
+//
+// A repo made on a transaction model runs in that transaction.
+type Repo[T any] struct {
+	m       *Model
+	pk      string
+	pkIndex []int
+}
+
+// ListOptions filters, orders and limits Repo.List, zero values are
+// ignored. OrderBy is trusted SQL as for Model.OrderBy.
+type ListOptions struct {
+	Cond     *Cond
+	OrderBy  string
+	Limit    int
+	Offset   int
+	Preload  []string
+	Unscoped bool
+}
+
+// NewRepo returns the repository of T on m, the primary key and
+// columns of T are resolved once here. T must be a struct.
+func NewRepo[T any](m *Model) *Repo[T] {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("orm: repo needs a struct type, got %v", t))
+	}
+	r := &Repo[T]{m: m}
+	if pk, err := m.parse.ScanPk(reflect.New(t).Elem()); err == nil {
+		r.pk, r.pkIndex = pk, m.parse.Columns(t)[pk]
+	}
+	return r
+}
+
+// Model returns a session bound to the table of T for other queries.
+func (r *Repo[T]) Model() *Model {
+	return r.m.Model(new(T))
+}
+
+// Find returns the row with primary key id, RECORD_NOT_FOUND when
+// there is none.
+func (r *Repo[T]) Find(id interface{}) (*T, error) {
+	if r.pk == "" {
+		return nil, fmt.Errorf("%T has no primary key", *new(T))
+	}
+	return r.first(r.Model().Where(Values{r.pk: id}))
+}
+
+// First returns the first row matching the condition, taken as by
+// Model.Where, RECORD_NOT_FOUND when there is none.
+func (r *Repo[T]) First(query interface{}, args ...interface{}) (*T, error) {
+	return r.first(r.Model().Where(query, args...))
+}
+
+func (r *Repo[T]) first(m *Model) (*T, error) {
+	list := make([]T, 0, 1)
+	if err := m.Limit(1).FindAll(&list); err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, RECORD_NOT_FOUND
+	}
+	return &list[0], nil
+}
+
+func (r *Repo[T]) List(opts ListOptions) ([]T, error) {
+	m := r.Model()
+	if opts.Cond != nil {
+		m.Where(opts.Cond)
+	}
+	if opts.OrderBy != "" {
+		m.OrderBy(opts.OrderBy)
+	}
+	if opts.Limit > 0 {
+		m.Limit(opts.Offset, opts.Limit)
+	} else if opts.Offset > 0 {
+		m.offset = opts.Offset
+	}
+	if len(opts.Preload) > 0 {
+		m.Preload(opts.Preload...)
+	}
+	if opts.Unscoped {
+		m.Unscoped()
+	}
+	list := make([]T, 0)
+	if err := m.FindAll(&list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Count returns the number of rows matching the condition, taken as
+// by Model.Where, or of all rows when query is nil.
+func (r *Repo[T]) Count(query interface{}, args ...interface{}) (int64, error) {
+	m := r.Model()
+	if query != nil {
+		m.Where(query, args...)
+	}
+	return m.Count()
+}
+
+// Create inserts v and writes the generated primary key back into it.
+func (r *Repo[T]) Create(v *T) error {
+	m := r.Model()
+	if _, err := m.Insert(v); err != nil {
+		return err
+	}
+	if r.pkIndex != nil {
+		if field := reflect.ValueOf(v).Elem().FieldByIndex(r.pkIndex); field.IsZero() {
+			setGeneratedKey(field, m.lastInsertId)
+		}
+	}
+	return nil
+}
+
+// Update saves v by primary key and returns the number of changed rows.
+func (r *Repo[T]) Update(v *T) (int64, error) {
+	return r.Model().Update(v)
+}
+
+// Delete removes v by primary key, soft deletes it when T has a soft
+// delete column.
+func (r *Repo[T]) Delete(v *T) (int64, error) {
+	return r.Model().Delete(v)
+}
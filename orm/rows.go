@@ -0,0 +1,267 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+)
+
+// STOP_ITERATION ends Each early without error.
+var STOP_ITERATION = errors.New("stop iteration")
+
+// Rows streams the result of a query one row at a time, it must be
+// closed unless Next returned false.
+//
+//	rows, err := m.Model(&User{}).Where("age > ?", 18).Rows()
+//	defer rows.Close()
+//	for rows.Next() {
+//		var u User
+//		if err := rows.Scan(&u); err != nil { ... }
+//	}
+//	err = rows.Err()
+type Rows struct {
+	m       *Model
+	ctx     context.Context
+	hookCtx context.Context
+	event   *QueryEvent
+	rows    *sql.Rows
+	columns []string
+	release func(failed bool)
+	err     error
+	closed  bool
+}
+
+// Rows runs the query of the session and returns its rows unread.
+func (m *Model) Rows() (*Rows, error) {
+	m = m.instance()
+	s, args := m.buildQuery()
+	return m.rows(s, args)
+}
+
+func (m *Model) rows(str string, args []interface{}) (*Rows, error) {
+	defer m.flush()
+	if err := m.checkSorts(); err != nil {
+		return nil, err
+	}
+	str, args = inline(str, args)
+	m.lastSql = str
+	ctx, e := m.traceStart(str, args)
+	r := &Rows{m: m, ctx: ctx, hookCtx: m.ctx, event: e}
+	stmt, release, err := m.prepare(ctx, m.reader(), rebind(m.dialect, str))
+	if err != nil {
+		return nil, r.fail(err)
+	}
+	res, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		release(true)
+		return nil, r.fail(err)
+	}
+	r.rows, r.release = res, release
+	if r.columns, err = res.Columns(); err != nil {
+		r.err = err
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// fail ends the trace of a query which could not be run.
+func (r *Rows) fail(err error) error {
+	r.closed = true
+	if r.event != nil {
+		r.event.RowsAffected, r.event.Err = -1, err
+		r.m.traceEnd(r.ctx, r.event)
+	}
+	return err
+}
+
+// Next prepares the next row for Scan, it closes the rows and returns
+// false once they are exhausted or an error occurred.
+func (r *Rows) Next() bool {
+	if r.closed {
+		return false
+	}
+	if r.err == nil && r.rows.Next() {
+		return true
+	}
+	r.Close()
+	return false
+}
+
+// Columns returns the column names of the result.
+func (r *Rows) Columns() []string {
+	return r.columns
+}
+
+// Scan decodes the current row into the struct v points to with the
+// same tag rules as FindAll, AfterFind is called on it.
+func (r *Rows) Scan(v interface{}) error {
+	refValue := reflect.ValueOf(v)
+	if refValue.Kind() != reflect.Ptr || refValue.Elem().Kind() != reflect.Struct {
+		return errors.New("needs a pointer to a struct")
+	}
+	refValue = refValue.Elem()
+	if err := r.m.parse.scanStruct(r.rows, r.columns, refValue); err != nil {
+		r.err = err
+		return err
+	}
+	r.m.remember(refValue, nil)
+	return r.m.afterFind(r.hookCtx, []reflect.Value{refValue})
+}
+
+// ScanMap returns the current row as a map of raw column values.
+func (r *Rows) ScanMap() (map[string][]byte, error) {
+	values := make([]sql.RawBytes, len(r.columns))
+	scans := make([]interface{}, len(r.columns))
+	for i := range values {
+		scans[i] = &values[i]
+	}
+	if err := r.rows.Scan(scans...); err != nil {
+		r.err = err
+		return nil, err
+	}
+	row := make(map[string][]byte, len(r.columns))
+	for i, column := range r.columns {
+		if values[i] != nil {
+			row[column] = append([]byte{}, values[i]...)
+		}
+	}
+	return row, nil
+}
+
+// Err returns the error which ended the iteration.
+func (r *Rows) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.rows != nil {
+		return r.rows.Err()
+	}
+	return nil
+}
+
+// Close releases the connection of the rows, it is safe to call
+// it more than once.
+func (r *Rows) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	failed := r.rows.Err()
+	err := r.rows.Close()
+	if failed == nil {
+		failed = err
+	}
+	if r.err == nil {
+		r.err = failed
+	}
+	r.release(failed != nil)
+	if r.event != nil {
+		r.event.RowsAffected, r.event.Err = -1, r.err
+		r.m.traceEnd(r.ctx, r.event)
+	}
+	return err
+}
+
+// Each streams the rows of the session into fn, a func(*T) error where
+// T is a struct, without loading them all in memory. A new T is
+// allocated for every row. Returning STOP_ITERATION, wrapped or not,
+// ends the loop early without error, any other error ends it and is
+// returned.
+//
+//	err := m.Where("active = ?", 1).Each(func(u *User) error {
+//		...
+//	})
+func (m *Model) Each(fn interface{}) error {
+	m = m.instance()
+	fnValue := reflect.ValueOf(fn)
+	fnType := fnValue.Type()
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	if fnType.Kind() != reflect.Func || fnType.NumIn() != 1 || fnType.NumOut() != 1 ||
+		fnType.In(0).Kind() != reflect.Ptr || fnType.In(0).Elem().Kind() != reflect.Struct ||
+		fnType.Out(0) != errorType {
+		return errors.New("needs a func(*struct) error")
+	}
+	elem := fnType.In(0).Elem()
+	m.bind(elem)
+	rows, err := m.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		v := reflect.New(elem)
+		if err := rows.Scan(v.Interface()); err != nil {
+			return err
+		}
+		if out := fnValue.Call([]reflect.Value{v})[0]; !out.IsNil() {
+			if err := out.Interface().(error); !errors.Is(err, STOP_ITERATION) {
+				return err
+			}
+			return nil
+		}
+	}
+	return rows.Err()
+}
+
+// Cursor is a typed iterator over the rows of a query.
+//
+//	c, err := orm.NewCursor[User](m.Where("age > ?", 18))
+//	defer c.Close()
+//	for c.Next() {
+//		u := c.Value()
+//	}
+//	err = c.Err()
+type Cursor[T any] struct {
+	rows  *Rows
+	value *T
+	err   error
+}
+
+// NewCursor runs the query of the session m, the table defaults to
+// the one of T.
+func NewCursor[T any](m *Model) (*Cursor[T], error) {
+	m = m.instance()
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return nil, errors.New("needs a struct type")
+	}
+	m.bind(t)
+	rows, err := m.Rows()
+	if err != nil {
+		return nil, err
+	}
+	return &Cursor[T]{rows: rows}, nil
+}
+
+// Next decodes the next row, it returns false at the end of the rows
+// or on error.
+func (c *Cursor[T]) Next() bool {
+	if c.err != nil || !c.rows.Next() {
+		return false
+	}
+	c.value = new(T)
+	if err := c.rows.Scan(c.value); err != nil {
+		c.err = err
+		c.rows.Close()
+		return false
+	}
+	return true
+}
+
+// Value returns the row decoded by the last call to Next.
+func (c *Cursor[T]) Value() *T {
+	return c.value
+}
+
+func (c *Cursor[T]) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.rows.Err()
+}
+
+func (c *Cursor[T]) Close() error {
+	return c.rows.Close()
+}
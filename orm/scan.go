@@ -0,0 +1,146 @@
+package orm
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Columns maps every column of struct t to the index path of its field,
+// anonymous embedded structs are flattened into the parent. The map is
+// cached and must not be modified.
+func (p *Parser) Columns(t reflect.Type) map[string][]int {
+	return p.schema(t).columns
+}
+
+// isEmbedded reports whether f is an anonymous struct to flatten,
+// an explicit field tag keeps it as a single column.
+func isEmbedded(f reflect.StructField) bool {
+	if !f.Anonymous {
+		return false
+	}
+	t := f.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return false
+	}
+	tag := tagOf(f)
+	return !tag.Has(FIELD_TAG) && !tag.Has(IGNORE_TAG)
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex allocating nil embedded pointers.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// scanStruct scans the current row of rows into the struct v.
+func (p *Parser) scanStruct(rows *sql.Rows, columns []string, v reflect.Value) error {
+	s := p.schema(v.Type())
+	dest := make([]interface{}, len(columns))
+	// optional fields are scanned through a pointer, so that NULL
+	// columns leave the nested struct nil
+	var optional []*schemaField
+	var holders []reflect.Value
+	for i, col := range columns {
+		f, ok := s.byColumn[col]
+		switch {
+		case !ok:
+			dest[i] = new(interface{})
+		case f.optional && !f.json:
+			holder := reflect.New(reflect.PtrTo(f.field.Type)).Elem()
+			optional, holders = append(optional, f), append(holders, holder)
+			dest[i] = scanTarget(holder)
+		case f.json:
+			dest[i] = &jsonScanner{field: fieldByIndex(v, f.index)}
+		default:
+			dest[i] = scanTarget(fieldByIndex(v, f.index))
+		}
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return err
+	}
+	for i, f := range optional {
+		if !holders[i].IsNil() {
+			fieldByIndex(v, f.index).Set(holders[i].Elem())
+		}
+	}
+	return nil
+}
+
+func scanTarget(field reflect.Value) interface{} {
+	addr := field.Addr()
+	if _, ok := addr.Interface().(sql.Scanner); ok {
+		return addr.Interface()
+	}
+	t := field.Type()
+	if t == timeType || (t.Kind() == reflect.Ptr && t.Elem() == timeType) {
+		return &timeScanner{field: field}
+	}
+	return addr.Interface()
+}
+
+// timeScanner accepts driver time values, unix timestamps and the
+// text layouts Parser.Decode understands.
+type timeScanner struct {
+	field reflect.Value
+}
+
+func (s *timeScanner) Scan(src interface{}) error {
+	if src == nil {
+		s.field.Set(reflect.Zero(s.field.Type()))
+		return nil
+	}
+	var t time.Time
+	switch v := src.(type) {
+	case time.Time:
+		t = v
+	case int64:
+		t = time.Unix(v, 0)
+	case []byte:
+		var err error
+		if t, err = parseTime(string(v)); err != nil {
+			return err
+		}
+	case string:
+		var err error
+		if t, err = parseTime(v); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupport time value %T", src)
+	}
+	if s.field.Kind() == reflect.Ptr {
+		s.field.Set(reflect.ValueOf(&t))
+	} else {
+		s.field.Set(reflect.ValueOf(t))
+	}
+	return nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if timestamp, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(timestamp, 0), nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04:05.000 -0700", "2006-01-02 15:04:05.999999999-07:00", time.RFC3339Nano, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("unsupport time value:" + s)
+}
@@ -0,0 +1,263 @@
+package orm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// tags caches the parsed db tag of every struct tag string,
+// a FieldTag is never modified once parsed.
+var tags sync.Map
+
+// tagOf returns the parsed db tag of f.
+func tagOf(f reflect.StructField) *FieldTag {
+	s := f.Tag.Get(FIELD_TAG_NAME)
+	if tag, ok := tags.Load(s); ok {
+		return tag.(*FieldTag)
+	}
+	tag, _ := tags.LoadOrStore(s, NewTag(s))
+	return tag.(*FieldTag)
+}
+
+// schema is the layout of a struct type, parsed once by Parser.schema.
+type schema struct {
+	// flat are the columns in field order, anonymous embedded structs
+	// and nested structs with a prefix tag are flattened
+	flat     []*schemaField
+	columns  map[string][]int
+	byColumn map[string]*schemaField
+	pk       *schemaField
+	// err is the first misuse of a tag, reported when t is bound
+	err error
+}
+
+type schemaField struct {
+	field reflect.StructField
+	index []int
+	name  string
+	tag   *FieldTag
+	pk    bool
+	json  bool
+	// optional fields are reached through a pointer which may be nil
+	optional bool
+	decode   func(val []byte, dst reflect.Value) error
+}
+
+// schema returns the cached layout of struct t, it is safe for
+// concurrent use.
+func (p *Parser) schema(t reflect.Type) *schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if s, ok := p.schemas.Load(t); ok {
+		return s.(*schema)
+	}
+	s := &schema{
+		columns:  make(map[string][]int),
+		byColumn: make(map[string]*schemaField),
+	}
+	p.flatten(t, nil, "", false, s)
+	for _, f := range s.flat {
+		if f.pk {
+			s.pk = f
+			break
+		}
+	}
+	cached, _ := p.schemas.LoadOrStore(t, s)
+	return cached.(*schema)
+}
+
+// flatten adds the columns of t to s with their names prefixed,
+// the first field of a name wins.
+func (p *Parser) flatten(t reflect.Type, index []int, prefix string, optional bool, s *schema) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		path := append(append([]int(nil), index...), i)
+		if isEmbedded(f) {
+			p.flatten(f.Type, path, prefix+tagOf(f).Get(PREFIX_TAG), optional || f.Type.Kind() == reflect.Ptr, s)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if isNested(f) {
+			p.flatten(f.Type, path, prefix+tagOf(f).Get(PREFIX_TAG), optional || f.Type.Kind() == reflect.Ptr, s)
+			continue
+		}
+		name, err := p.FieldName(f)
+		if err != nil {
+			continue
+		}
+		tag := tagOf(f)
+		sf := &schemaField{
+			field:  f,
+			index:  path,
+			name:   prefix + name,
+			tag:    tag,
+			pk:     tag.Has(PK_TAG),
+			json:   tag.Has(JSON_TAG),
+			decode: decoder(f.Type),
+
+			optional: optional,
+		}
+		if sf.json {
+			sf.decode = decodeJSON
+		}
+		for _, name := range []string{AUTO_CREATE_TIME_TAG, AUTO_UPDATE_TIME_TAG, SOFT_DELETE_TAG} {
+			if tag.Has(name) && !isTimeField(f.Type) && s.err == nil {
+				s.err = fmt.Errorf("%v.%v: %v needs a time or integer field, not %v", t.Name(), f.Name, name, f.Type)
+			}
+		}
+		if _, ok := s.columns[sf.name]; !ok {
+			s.columns[sf.name] = path
+			s.byColumn[sf.name] = sf
+			s.flat = append(s.flat, sf)
+		}
+	}
+}
+
+// isNested reports whether f is a named struct field whose columns
+// are stored in the parent table under a prefix:
+//
+//	Address Address `db:"prefix:address_"`
+func isNested(f reflect.StructField) bool {
+	t := f.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType && tagOf(f).Has(PREFIX_TAG)
+}
+
+// value returns the field of the struct value v, ok is false when a
+// nil pointer is in the way.
+func (f *schemaField) value(v reflect.Value) (reflect.Value, bool) {
+	field, err := v.FieldByIndexErr(f.index)
+	return field, err == nil
+}
+
+// encode returns the value stored in the column of f, JSON fields are
+// marshalled to text and stored as NULL when nil.
+func (f *schemaField) encode(field reflect.Value) (interface{}, error) {
+	if !f.json {
+		return field.Interface(), nil
+	}
+	switch field.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Ptr, reflect.Interface:
+		if field.IsNil() {
+			return nil, nil
+		}
+	}
+	data, err := json.Marshal(field.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("column %v: %w", f.name, err)
+	}
+	return string(data), nil
+}
+
+func decodeJSON(val []byte, dst reflect.Value) error {
+	dst.Set(reflect.Zero(dst.Type()))
+	if len(val) == 0 {
+		return nil
+	}
+	return json.Unmarshal(val, dst.Addr().Interface())
+}
+
+// jsonScanner scans a text column into a JSON field.
+type jsonScanner struct {
+	field reflect.Value
+}
+
+func (s *jsonScanner) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		s.field.Set(reflect.Zero(s.field.Type()))
+		return nil
+	case []byte:
+		return decodeJSON(v, s.field)
+	case string:
+		return decodeJSON([]byte(v), s.field)
+	}
+	return fmt.Errorf("unsupport json value %T", src)
+}
+
+// decoder returns the func converting the text of a column to a
+// field of type t, used by Parser.Decode.
+func decoder(t reflect.Type) func(val []byte, dst reflect.Value) error {
+	switch t.Kind() {
+	case reflect.String:
+		return func(val []byte, dst reflect.Value) error {
+			dst.SetString(string(val))
+			return nil
+		}
+	case reflect.Bool:
+		return func(val []byte, dst reflect.Value) error {
+			dst.SetBool(string(val) == "1")
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(val []byte, dst reflect.Value) error {
+			n, err := strconv.ParseInt(string(val), 10, t.Bits())
+			if err != nil {
+				return INVALID_TYPE
+			}
+			dst.SetInt(n)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(val []byte, dst reflect.Value) error {
+			n, err := strconv.ParseUint(string(val), 10, t.Bits())
+			if err != nil {
+				return INVALID_TYPE
+			}
+			dst.SetUint(n)
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		return func(val []byte, dst reflect.Value) error {
+			n, err := strconv.ParseFloat(string(val), t.Bits())
+			if err != nil {
+				return INVALID_TYPE
+			}
+			dst.SetFloat(n)
+			return nil
+		}
+	case reflect.Ptr:
+		elem := decoder(t.Elem())
+		return func(val []byte, dst reflect.Value) error {
+			if val == nil {
+				dst.Set(reflect.Zero(t))
+				return nil
+			}
+			v := reflect.New(t.Elem())
+			if err := elem(val, v.Elem()); err != nil {
+				return err
+			}
+			dst.Set(v)
+			return nil
+		}
+	case reflect.Struct:
+		if t == timeType {
+			return func(val []byte, dst reflect.Value) error {
+				v, err := parseTime(string(val))
+				if err != nil {
+					return errors.New("unsupport type:" + t.String())
+				}
+				dst.Set(reflect.ValueOf(v))
+				return nil
+			}
+		}
+		return func(val []byte, dst reflect.Value) error {
+			return errors.New("unsupport type:" + t.String())
+		}
+	}
+	return func(val []byte, dst reflect.Value) error {
+		return errors.New("unsupport type:" + t.Kind().String())
+	}
+}
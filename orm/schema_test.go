@@ -0,0 +1,90 @@
+package orm
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type benchAddress struct {
+	City string `db:"field:city"`
+	Zip  string `db:"field:zip"`
+}
+
+type benchUser struct {
+	Id      int64        `db:"field:id;pk;auto"`
+	Name    string       `db:"field:name"`
+	Email   string       `db:"field:email"`
+	Age     int8         `db:"field:age"`
+	Score   float64      `db:"field:score"`
+	Active  bool         `db:"field:active"`
+	Nick    *string      `db:"field:nick"`
+	Created time.Time    `db:"field:created_at;autoCreateTime"`
+	Address benchAddress `db:"prefix:address_"`
+	Secret  string       `db:"ignore"`
+}
+
+var benchRow = map[string][]byte{
+	"id":           []byte("42"),
+	"name":         []byte("loso"),
+	"email":        []byte("loso@example.com"),
+	"age":          []byte("30"),
+	"score":        []byte("9.5"),
+	"active":       []byte("1"),
+	"nick":         []byte("lo"),
+	"created_at":   []byte("2024-01-02 03:04:05"),
+	"address_city": []byte("Paris"),
+	"address_zip":  []byte("75001"),
+}
+
+// benchParsers runs f with a parser keeping its schemas across the
+// iterations, then with a fresh parser and tag cache on every iteration.
+func benchParsers(b *testing.B, f func(b *testing.B, p *Parser)) {
+	b.Run("cached", func(b *testing.B) {
+		p := &Parser{}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			f(b, p)
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			tags.Range(func(k, _ interface{}) bool {
+				tags.Delete(k)
+				return true
+			})
+			b.StartTimer()
+			f(b, &Parser{})
+		}
+	})
+}
+
+func BenchmarkDecode(b *testing.B) {
+	benchParsers(b, func(b *testing.B, p *Parser) {
+		var u benchUser
+		if err := p.Decode(benchRow, &u); err != nil {
+			b.Fatal(err)
+		}
+	})
+}
+
+func BenchmarkEncode(b *testing.B) {
+	nick := "lo"
+	u := &benchUser{Id: 42, Name: "loso", Email: "loso@example.com", Nick: &nick, Created: time.Now()}
+	benchParsers(b, func(b *testing.B, p *Parser) {
+		if _, err := p.Encode(u); err != nil {
+			b.Fatal(err)
+		}
+	})
+}
+
+func BenchmarkScanPk(b *testing.B) {
+	v := reflect.ValueOf(&benchUser{Id: 42}).Elem()
+	benchParsers(b, func(b *testing.B, p *Parser) {
+		if _, err := p.ScanPk(v); err != nil {
+			b.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package orm
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"sync"
+)
+
+const (
+	DEFAULT_STMT_CACHE_SIZE = 64
+)
+
+// stmtCache is a LRU cache of prepared statements keyed by database
+// and SQL text. Entries are reference counted, an evicted statement is
+// closed once the last query using it is done.
+type stmtCache struct {
+	mu    sync.Mutex
+	size  int
+	items map[stmtKey]*list.Element
+	lru   *list.List
+}
+
+type stmtKey struct {
+	db  *sql.DB
+	sql string
+}
+
+type stmtEntry struct {
+	key     stmtKey
+	stmt    *sql.Stmt
+	refs    int
+	evicted bool
+}
+
+func newStmtCache(size int) *stmtCache {
+	return &stmtCache{
+		size:  size,
+		items: make(map[stmtKey]*list.Element),
+		lru:   list.New(),
+	}
+}
+
+// lookup returns the cached statement of str on db, nil when missing.
+func (c *stmtCache) lookup(db *sql.DB, str string) *stmtEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[stmtKey{db: db, sql: str}]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	e := el.Value.(*stmtEntry)
+	e.refs++
+	return e
+}
+
+// get returns the statement of str, preparing it on db when missing.
+func (c *stmtCache) get(ctx context.Context, db *sql.DB, str string) (*stmtEntry, error) {
+	if e := c.lookup(db, str); e != nil {
+		return e, nil
+	}
+	key := stmtKey{db: db, sql: str}
+	stmt, err := db.PrepareContext(ctx, str)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		// prepared concurrently, keep the cached one
+		stmt.Close()
+		c.lru.MoveToFront(el)
+		e := el.Value.(*stmtEntry)
+		e.refs++
+		return e, nil
+	}
+	e := &stmtEntry{key: key, stmt: stmt, refs: 1}
+	c.items[key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+	return e, nil
+}
+
+func (c *stmtCache) release(e *stmtEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.refs--
+	if e.evicted && e.refs == 0 {
+		e.stmt.Close()
+	}
+}
+
+// evict drops the statement e, used when it failed because its
+// connection was lost or the schema changed.
+func (c *stmtCache) evict(e *stmtEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[e.key]; ok && el.Value == e {
+		c.remove(el)
+	}
+}
+
+func (c *stmtCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *stmtCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*stmtEntry)
+	delete(c.items, e.key)
+	e.evicted = true
+	if e.refs == 0 {
+		e.stmt.Close()
+	}
+}
+
+// SetStmtCacheSize sets the number of prepared statements kept by the
+// root model, 0 disables the cache. Call it before the model is shared,
+// it panics on a session or transaction.
+func (m *Model) SetStmtCacheSize(size int) *Model {
+	m.root("SetStmtCacheSize")
+	if m.stmts != nil {
+		m.stmts.clear()
+		m.stmts = nil
+	}
+	if size > 0 {
+		m.stmts = newStmtCache(size)
+	}
+	return m
+}
+
+// prepare returns the statement of str on db and the func releasing
+// it. In a transaction a cached statement is bound to it with tx.Stmt,
+// a missing one is prepared on the transaction and not cached: the
+// cache would need a second connection of the pool.
+func (m *Model) prepare(ctx context.Context, db *sql.DB, str string) (*sql.Stmt, func(failed bool), error) {
+	var e *stmtEntry
+	if m.stmts != nil && m.tx != nil {
+		e = m.stmts.lookup(db, str)
+	} else if m.stmts != nil {
+		var err error
+		if e, err = m.stmts.get(ctx, db, str); err != nil {
+			return nil, nil, err
+		}
+	}
+	if e == nil {
+		var conn executor = db
+		if m.tx != nil {
+			conn = m.tx
+		}
+		stmt, err := conn.PrepareContext(ctx, str)
+		if err != nil {
+			return nil, nil, err
+		}
+		return stmt, func(bool) { stmt.Close() }, nil
+	}
+	stmt := e.stmt
+	if m.tx != nil {
+		stmt = m.tx.StmtContext(ctx, e.stmt)
+	}
+	return stmt, func(failed bool) {
+		if m.tx != nil {
+			stmt.Close()
+		}
+		if failed {
+			m.stmts.evict(e)
+		}
+		m.stmts.release(e)
+	}, nil
+}
@@ -0,0 +1,157 @@
+package orm
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	AUTO_CREATE_TIME_TAG = "autoCreateTime"
+	AUTO_UPDATE_TIME_TAG = "autoUpdateTime"
+	SOFT_DELETE_TAG      = "softDelete"
+)
+
+var nullTimeType = reflect.TypeOf(sql.NullTime{})
+
+// Unscoped includes soft deleted rows in queries and makes
+// Delete remove rows of soft delete models for real.
+func (m *Model) Unscoped() *Model {
+	m = m.instance()
+	m.unscoped = true
+	return m
+}
+
+// bind records the struct type of the session, the element type of
+// a slice or array, the table name defaults to the type name. Any
+// other type is kept as the error of the session.
+func (m *Model) bind(t reflect.Type) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		if m.err == nil {
+			m.err = fmt.Errorf("needs a struct type, got %v", t)
+		}
+		return
+	}
+	if m.model == nil {
+		m.model = t
+	}
+	if m.table == "" {
+		m.table = m.dialect.Quote(m.parse.TableName(t))
+	}
+	if err := m.parse.schema(t).err; err != nil && m.err == nil {
+		m.err = err
+	}
+}
+
+// taggedColumns returns the columns of struct t whose tag has name.
+func (p *Parser) taggedColumns(t reflect.Type, name string) map[string][]int {
+	result := make(map[string][]int)
+	for _, f := range p.schema(t).flat {
+		if f.tag.Has(name) {
+			result[f.name] = f.index
+		}
+	}
+	return result
+}
+
+// softDelete returns the soft delete column of struct t.
+func (p *Parser) softDelete(t reflect.Type) (string, reflect.Type, bool) {
+	for column, index := range p.taggedColumns(t, SOFT_DELETE_TAG) {
+		return column, t.FieldByIndex(index).Type, true
+	}
+	return "", nil, false
+}
+
+// touch writes now into the columns of v tagged with name, into the
+// struct when it is addressable. Set fields are kept when onlyZero.
+func (p *Parser) touch(v reflect.Value, columns map[string]interface{}, name string, now time.Time, onlyZero bool) {
+	for column, index := range p.taggedColumns(v.Type(), name) {
+		field := v
+		if v.CanSet() {
+			field = fieldByIndex(v, index)
+		} else if f, err := v.FieldByIndexErr(index); err == nil {
+			field = f
+		} else {
+			continue
+		}
+		if onlyZero && !field.IsZero() {
+			continue
+		}
+		value, ok := timeValue(field.Type(), now)
+		if !ok {
+			// reported by bind
+			continue
+		}
+		if field.CanSet() {
+			field.Set(value)
+		}
+		columns[column] = value.Interface()
+	}
+}
+
+// isTimeField reports whether a field of type t can hold the time of
+// the timestamp and soft delete tags.
+func isTimeField(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return t == timeType || t == nullTimeType || t.Kind() == reflect.Ptr && t.Elem() == timeType
+}
+
+// timeValue converts now to a time.Time, *time.Time, sql.NullTime or
+// integer unix timestamp of type t, ok is false for any other type.
+func timeValue(t reflect.Type, now time.Time) (reflect.Value, bool) {
+	switch {
+	case t == timeType:
+		return reflect.ValueOf(now), true
+	case t.Kind() == reflect.Ptr && t.Elem() == timeType:
+		return reflect.ValueOf(&now), true
+	case t == nullTimeType:
+		return reflect.ValueOf(sql.NullTime{Time: now, Valid: true}), true
+	case !isTimeField(t):
+		return reflect.Value{}, false
+	}
+	return reflect.ValueOf(now.Unix()).Convert(t), true
+}
+
+// softDeleteColumn returns the soft delete column of the bound
+// struct type, unless Unscoped is set.
+func (m *Model) softDeleteColumn() (string, reflect.Type, bool) {
+	if m.model == nil || m.unscoped {
+		return "", nil, false
+	}
+	return m.parse.softDelete(m.model)
+}
+
+// scope returns the condition of the session, soft deleted rows of
+// the bound struct type are excluded unless Unscoped is set.
+func (m *Model) scope() *Cond {
+	column, t, ok := m.softDeleteColumn()
+	if !ok {
+		return m.cond
+	}
+	if fields := strings.Fields(m.table); len(fields) > 0 {
+		// the table or its alias, joined tables may have the column too
+		column = fields[len(fields)-1] + "." + m.dialect.Quote(column)
+	}
+	cond := NewCond().And(m.cond)
+	if t.Kind() == reflect.Ptr || t == timeType || t == nullTimeType {
+		return cond.Null(column)
+	}
+	return cond.push(condPart{glue: "AND", column: column, op: " = ?", args: []interface{}{0}})
+}
+
+// encodeSoftDelete stores a zero soft delete time as NULL.
+func (m *Model) encodeSoftDelete(t reflect.Type, columns map[string]interface{}) {
+	if column, ft, ok := m.parse.softDelete(t); ok && ft == timeType {
+		if v, ok := columns[column]; ok && isZero(v) {
+			columns[column] = nil
+		}
+	}
+}
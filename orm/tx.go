@@ -0,0 +1,106 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	NOT_IN_TRANSACTION = errors.New("not in transaction")
+)
+
+// executor is implemented by both *sql.DB and *sql.Tx
+type executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (m *Model) executor() executor {
+	if m.tx != nil {
+		return m.tx
+	}
+	return m.db
+}
+
+// Begin starts a transaction and returns a model bound to it,
+// calling Begin on a transaction model opens a nested savepoint.
+func (m *Model) Begin() (*Model, error) {
+	return m.BeginContext(m.context())
+}
+
+func (m *Model) BeginContext(ctx context.Context) (*Model, error) {
+	if m.tx != nil {
+		depth := m.depth + 1
+		if _, err := m.tx.ExecContext(ctx, fmt.Sprintf("SAVEPOINT sp_%d", depth)); err != nil {
+			return nil, err
+		}
+		return m.withTx(ctx, m.tx, depth), nil
+	}
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return m.withTx(ctx, tx, 0), nil
+}
+
+func (m *Model) Commit() error {
+	if m.tx == nil {
+		return NOT_IN_TRANSACTION
+	}
+	if m.depth > 0 {
+		_, err := m.tx.ExecContext(m.context(), fmt.Sprintf("RELEASE SAVEPOINT sp_%d", m.depth))
+		return err
+	}
+	return m.tx.Commit()
+}
+
+func (m *Model) Rollback() error {
+	if m.tx == nil {
+		return NOT_IN_TRANSACTION
+	}
+	if m.depth > 0 {
+		_, err := m.tx.ExecContext(m.context(), fmt.Sprintf("ROLLBACK TO SAVEPOINT sp_%d", m.depth))
+		return err
+	}
+	return m.tx.Rollback()
+}
+
+// Transaction runs fn inside a transaction (or a savepoint when m is
+// already in one). It commits when fn returns nil and rolls back when
+// fn returns an error or panics.
+func (m *Model) Transaction(fn func(tx *Model) error) (err error) {
+	return m.TransactionContext(m.context(), fn)
+}
+
+func (m *Model) TransactionContext(ctx context.Context, fn func(tx *Model) error) (err error) {
+	tx, err := m.BeginContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// withTx returns a root model bound to tx.
+func (m *Model) withTx(ctx context.Context, tx *sql.Tx, depth int) *Model {
+	t := &Model{
+		engine: m.engine,
+		tx:     tx,
+		depth:  depth,
+		txCtx:  ctx,
+	}
+	t.flush()
+	return t
+}
@@ -0,0 +1,203 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Tracked records the column values of a struct when it is found or
+// written, embed it to make Update write only the changed columns:
+//
+//	type User struct {
+//		orm.Tracked
+//		Id   int64  `db:"field:id;pk;auto"`
+//		Name string `db:"field:name"`
+//	}
+type Tracked struct {
+	snapshot map[string]interface{}
+}
+
+func (t *Tracked) tracked() *Tracked {
+	return t
+}
+
+type tracker interface {
+	tracked() *Tracked
+}
+
+var trackerType = reflect.TypeOf((*tracker)(nil)).Elem()
+
+// trackerOf returns the Tracked embedded in the struct v, nil when
+// there is none.
+func trackerOf(v reflect.Value) *Tracked {
+	if !v.CanAddr() || !v.Addr().Type().Implements(trackerType) {
+		return nil
+	}
+	return v.Addr().Interface().(tracker).tracked()
+}
+
+// Omit excludes columns from the next Insert, InsertBatch, Update or
+// Updates. The version column of Update is always written.
+func (m *Model) Omit(columns ...string) *Model {
+	m = m.instance()
+	m.omits = append(m.omits, columns...)
+	return m
+}
+
+// UpdateColumns updates v like Update but writes only the given
+// columns, along with the version and auto update time columns.
+//
+//	m.UpdateColumns(&user, "name", "email")
+func (m *Model) UpdateColumns(v interface{}, columns ...string) (int64, error) {
+	m = m.instance()
+	if len(columns) == 0 {
+		return 0, errors.New("no columns to update")
+	}
+	m.picks = append(m.picks, columns...)
+	return m.Update(v)
+}
+
+// Updates sets the columns of values on every row matched by the
+// session, Expression values are written as SQL:
+//
+//	m.Model(&User{}).Where("id = ?", id).Updates(orm.Values{
+//		"name":   "loso",
+//		"visits": orm.Expr("visits + ?", 1),
+//	})
+//
+// Hooks are not called. The auto update time columns of the bound
+// struct are touched, its version column is incremented and its soft
+// deleted rows are left out. Without a condition every row is updated.
+func (m *Model) Updates(values Values) (int64, error) {
+	m = m.instance()
+	if m.table == "" {
+		return 0, errors.New("needs a table")
+	}
+	columns := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		columns[k] = v
+	}
+	if m.model != nil {
+		now := time.Now()
+		for column, index := range m.parse.taggedColumns(m.model, AUTO_UPDATE_TIME_TAG) {
+			if _, ok := columns[column]; !ok {
+				if value, ok := timeValue(m.model.FieldByIndex(index).Type, now); ok {
+					columns[column] = value.Interface()
+				}
+			}
+		}
+		for column := range m.parse.taggedColumns(m.model, VERSION_TAG) {
+			// stale copies of the rows must fail their next Update
+			if _, ok := columns[column]; !ok {
+				columns[column] = Expr(m.dialect.Quote(column) + " + 1")
+			}
+		}
+	}
+	m.omit(columns)
+	return m.update(columns)
+}
+
+// update writes columns to the rows matched by the session.
+func (m *Model) update(columns map[string]interface{}) (int64, error) {
+	if len(columns) == 0 {
+		return 0, errors.New("no columns to update")
+	}
+	keys, values := m.parseColumns(columns)
+	where, args := m.where()
+	s := populateSql("UPDATE %TABLE% SET %VALUES% %WHERE%%ORDER%%LIMIT%", map[string]string{
+		"%TABLE%":  m.table,
+		"%VALUES%": keys,
+		"%WHERE%":  where,
+		"%ORDER%":  m.orderBy,
+		"%LIMIT%":  m.dialect.Limit(m.limit, m.offset),
+	})
+	if _, err := m.Execute(s, append(values, args...)...); err != nil {
+		return 0, err
+	}
+	return m.affectedRows, nil
+}
+
+func (m *Model) omit(columns map[string]interface{}) {
+	for _, column := range m.omits {
+		delete(columns, column)
+	}
+}
+
+// pick keeps the columns given to UpdateColumns or, when v embeds
+// Tracked, the columns changed since its snapshot. It returns false
+// when a tracked v has no change.
+func (m *Model) pick(v reflect.Value, columns map[string]interface{}) (bool, error) {
+	if len(m.picks) > 0 {
+		s := m.parse.schema(v.Type())
+		keep := make(map[string]bool, len(m.picks))
+		for _, column := range m.picks {
+			if _, ok := s.byColumn[column]; !ok {
+				return false, fmt.Errorf("%w: %v has no column %q", INVALID_COLUMN, v.Type().Name(), column)
+			}
+			keep[column] = true
+		}
+		for column := range columns {
+			if !keep[column] {
+				delete(columns, column)
+			}
+		}
+		return true, nil
+	}
+	t := trackerOf(v)
+	if t == nil || t.snapshot == nil {
+		return true, nil
+	}
+	for column, value := range columns {
+		if old, ok := t.snapshot[column]; ok && reflect.DeepEqual(old, snapshotValue(value)) {
+			delete(columns, column)
+		}
+	}
+	return len(columns) > 0, nil
+}
+
+// remember records the values of columns in the snapshot of v when it
+// embeds Tracked, all of its columns when columns is nil.
+func (m *Model) remember(v reflect.Value, columns map[string]interface{}) {
+	t := trackerOf(v)
+	if t == nil {
+		return
+	}
+	current, err := m.parse.Encode(v.Addr().Interface())
+	if err != nil {
+		return
+	}
+	snapshot := make(map[string]interface{}, len(current))
+	if columns != nil {
+		for column, value := range t.snapshot {
+			snapshot[column] = value
+		}
+	}
+	for column, value := range current {
+		if _, ok := columns[column]; ok || columns == nil {
+			snapshot[column] = snapshotValue(value)
+		}
+	}
+	// a new map, copies of the struct share the old one
+	t.snapshot = snapshot
+}
+
+// snapshotValue copies what the field may share with the struct, the
+// target of pointers and the bytes of slices.
+func snapshotValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return append([]byte(nil), value...)
+	}
+	refValue := reflect.ValueOf(v)
+	if refValue.Kind() == reflect.Ptr {
+		if refValue.IsNil() {
+			return nil
+		}
+		return snapshotValue(refValue.Elem().Interface())
+	}
+	return v
+}